@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxTimeSeriesBuckets bounds the size of a time series response
+	maxTimeSeriesBuckets = 1000
+
+	// Number of entries returned per breakdown category by default and at most
+	defaultBreakdownLimit = 10
+	maxBreakdownLimit     = 100
+)
+
+// ErrInvalidTimeSeries is returned for unsupported intervals and oversized ranges
+var ErrInvalidTimeSeries = errors.New("invalid time series")
+
+// timeSeriesInterval describes one bucket size of GET /{shortCode}/stats/timeseries
+type timeSeriesInterval struct {
+	// span is the default range when from is not given
+	span     time.Duration
+	truncate func(time.Time) time.Time
+	next     func(time.Time) time.Time
+}
+
+// timeSeriesIntervals are the supported bucket sizes. Weeks start on Monday.
+var timeSeriesIntervals = map[string]timeSeriesInterval{
+	"hour": {
+		span:     24 * time.Hour,
+		truncate: func(t time.Time) time.Time { return t.Truncate(time.Hour) },
+		next:     func(t time.Time) time.Time { return t.Add(time.Hour) },
+	},
+	"day": {
+		span:     30 * 24 * time.Hour,
+		truncate: truncateDay,
+		next:     func(t time.Time) time.Time { return t.AddDate(0, 0, 1) },
+	},
+	"week": {
+		span: 12 * 7 * 24 * time.Hour,
+		truncate: func(t time.Time) time.Time {
+			day := truncateDay(t)
+			return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+		},
+		next: func(t time.Time) time.Time { return t.AddDate(0, 0, 7) },
+	},
+}
+
+// truncateDay returns midnight UTC of t's day
+func truncateDay(t time.Time) time.Time {
+	year, month, day := t.UTC().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// TimeSeriesBucket is the number of clicks in the interval starting at Start
+type TimeSeriesBucket struct {
+	Start  time.Time `json:"start"`
+	Clicks int64     `json:"clicks"`
+}
+
+// TimeSeries represents clicks on a shortened URL bucketed over time.
+// Buckets cover From up to (but excluding) To without gaps, including empty ones.
+type TimeSeries struct {
+	ShortCode string             `json:"short_code"`
+	Interval  string             `json:"interval"`
+	From      time.Time          `json:"from"`
+	To        time.Time          `json:"to"`
+	Buckets   []TimeSeriesBucket `json:"buckets"`
+}
+
+// parseTimeParam parses an RFC 3339 timestamp or a plain date
+func parseTimeParam(name, value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%s must be an RFC 3339 timestamp or a YYYY-MM-DD date", name)
+}
+
+// parseOptionalTimeParam parses the named query parameter with parseTimeParam,
+// returning nil if it is not set
+func parseOptionalTimeParam(query url.Values, name string) (*time.Time, error) {
+	value := query.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	t, err := parseTimeParam(name, value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// parseTimeRange reads the from and to query parameters. to defaults to now,
+// and from to span before to.
+func parseTimeRange(r *http.Request, span time.Duration) (time.Time, time.Time, error) {
+	query := r.URL.Query()
+
+	to := time.Now().UTC()
+	if value := query.Get("to"); value != "" {
+		var err error
+		if to, err = parseTimeParam("to", value); err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+	}
+
+	from := to.Add(-span)
+	if value := query.Get("from"); value != "" {
+		var err error
+		if from, err = parseTimeParam("from", value); err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+	}
+
+	if from.After(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("from must not be after to")
+	}
+
+	return from, to, nil
+}
+
+// getTimeSeries counts clicks on a shortened URL per interval between from and to.
+// Bot clicks are only counted when includeBots is set.
+func (a *App) getTimeSeries(ctx context.Context, shortCode, interval string, from, to time.Time, includeBots bool) (*TimeSeries, error) {
+	spec, ok := timeSeriesIntervals[interval]
+	if !ok {
+		return nil, fmt.Errorf("%w: interval must be one of hour, day or week", ErrInvalidTimeSeries)
+	}
+
+	// Buckets run from the one containing from up to and including the one containing to
+	var starts []time.Time
+	for start := spec.truncate(from); !start.After(to); start = spec.next(start) {
+		if len(starts) == maxTimeSeriesBuckets {
+			return nil, fmt.Errorf("%w: time range covers more than %d buckets", ErrInvalidTimeSeries, maxTimeSeriesBuckets)
+		}
+		starts = append(starts, start)
+	}
+	end := spec.next(starts[len(starts)-1])
+
+	record, err := a.getURL(ctx, shortCode)
+	if err != nil {
+		return nil, err
+	}
+
+	counts, err := a.store.CountClicks(ctx, record.ID, interval, starts[0], end, includeBots)
+	if err != nil {
+		return nil, err
+	}
+
+	series := &TimeSeries{
+		ShortCode: record.ShortCode,
+		Interval:  interval,
+		From:      starts[0],
+		To:        end,
+		Buckets:   make([]TimeSeriesBucket, len(starts)),
+	}
+	for i, start := range starts {
+		series.Buckets[i] = TimeSeriesBucket{Start: start, Clicks: counts[start]}
+	}
+
+	return series, nil
+}
+
+// handleTimeSeries handles GET /{shortened}/stats/timeseries - returns clicks bucketed over time
+func (a *App) handleTimeSeries(w http.ResponseWriter, r *http.Request) {
+	logger := loggerFromContext(r.Context())
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	shortCode := strings.TrimSuffix(path, "/stats/timeseries")
+
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = "day"
+	}
+
+	spec, ok := timeSeriesIntervals[interval]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "interval must be one of hour, day or week")
+		return
+	}
+
+	from, to, err := parseTimeRange(r, spec.span)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	series, err := a.getTimeSeries(r.Context(), shortCode, interval, from, to, includeBots(r))
+	if errors.Is(err, ErrNotFound) {
+		logger.Warn("Short code not found for time series", "short_code", shortCode)
+		writeError(w, http.StatusNotFound, "Short code not found")
+		return
+	}
+	if errors.Is(err, ErrInvalidTimeSeries) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to get time series", "short_code", shortCode, "error", err)
+		writeError(w, http.StatusInternalServerError, "Failed to get time series")
+		return
+	}
+
+	logger.Info("Time series retrieved", "short_code", shortCode, "interval", interval, "buckets", len(series.Buckets))
+	writeJSON(w, http.StatusOK, series)
+}
+
+// BreakdownEntry is the number of clicks sharing one value, such as a browser family
+type BreakdownEntry struct {
+	Name   string `json:"name"`
+	Clicks int64  `json:"clicks"`
+}
+
+// StatsBreakdown represents the top referrer domains, browser families,
+// operating systems and device classes of clicks on a shortened URL.
+// Clicks are counted from From (inclusive) to To (exclusive) when they are set.
+type StatsBreakdown struct {
+	ShortCode        string           `json:"short_code"`
+	From             *time.Time       `json:"from,omitempty"`
+	To               *time.Time       `json:"to,omitempty"`
+	TotalClicks      int64            `json:"total_clicks"`
+	Referrers        []BreakdownEntry `json:"referrers"`
+	Browsers         []BreakdownEntry `json:"browsers"`
+	OperatingSystems []BreakdownEntry `json:"operating_systems"`
+	Devices          []BreakdownEntry `json:"devices"`
+}
+
+// topEntries returns the limit largest counts, ties broken by name
+func topEntries(counts map[string]int64, limit int) []BreakdownEntry {
+	entries := make([]BreakdownEntry, 0, len(counts))
+	for name, clicks := range counts {
+		entries = append(entries, BreakdownEntry{Name: name, Clicks: clicks})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Clicks != entries[j].Clicks {
+			return entries[i].Clicks > entries[j].Clicks
+		}
+		return entries[i].Name < entries[j].Name
+	})
+
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries
+}
+
+// getBreakdown aggregates the clicks on a shortened URL by referrer domain and
+// parsed user agent, keeping the top limit entries of each. Bot clicks are only
+// counted when includeBots is set.
+func (a *App) getBreakdown(ctx context.Context, shortCode string, limit int, from, to *time.Time, includeBots bool) (*StatsBreakdown, error) {
+	record, err := a.getURL(ctx, shortCode)
+	if err != nil {
+		return nil, err
+	}
+
+	sources, err := a.store.ClickSources(ctx, record.ID, from, to, includeBots)
+	if err != nil {
+		return nil, err
+	}
+
+	breakdown := &StatsBreakdown{ShortCode: record.ShortCode, From: from, To: to}
+	referrers := make(map[string]int64)
+	browsers := make(map[string]int64)
+	systems := make(map[string]int64)
+	devices := make(map[string]int64)
+
+	for _, source := range sources {
+		ua := parseUserAgent(source.UserAgent)
+		referrers[referrerDomain(source.Referer)] += source.Clicks
+		browsers[ua.Browser] += source.Clicks
+		systems[ua.OS] += source.Clicks
+		devices[ua.Device] += source.Clicks
+		breakdown.TotalClicks += source.Clicks
+	}
+
+	breakdown.Referrers = topEntries(referrers, limit)
+	breakdown.Browsers = topEntries(browsers, limit)
+	breakdown.OperatingSystems = topEntries(systems, limit)
+	breakdown.Devices = topEntries(devices, limit)
+
+	return breakdown, nil
+}
+
+// handleBreakdown handles GET /{shortened}/stats/breakdown - returns top referrers and user agents
+func (a *App) handleBreakdown(w http.ResponseWriter, r *http.Request) {
+	logger := loggerFromContext(r.Context())
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	shortCode := strings.TrimSuffix(path, "/stats/breakdown")
+	query := r.URL.Query()
+
+	limit := defaultBreakdownLimit
+	if value := query.Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxBreakdownLimit {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxBreakdownLimit))
+			return
+		}
+	}
+
+	from, err := parseOptionalTimeParam(query, "from")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	to, err := parseOptionalTimeParam(query, "to")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if from != nil && to != nil && from.After(*to) {
+		writeError(w, http.StatusBadRequest, "from must not be after to")
+		return
+	}
+
+	breakdown, err := a.getBreakdown(r.Context(), shortCode, limit, from, to, includeBots(r))
+	if errors.Is(err, ErrNotFound) {
+		logger.Warn("Short code not found for stats breakdown", "short_code", shortCode)
+		writeError(w, http.StatusNotFound, "Short code not found")
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to get stats breakdown", "short_code", shortCode, "error", err)
+		writeError(w, http.StatusInternalServerError, "Failed to get stats breakdown")
+		return
+	}
+
+	logger.Info("Stats breakdown retrieved", "short_code", shortCode, "clicks", breakdown.TotalClicks)
+	writeJSON(w, http.StatusOK, breakdown)
+}
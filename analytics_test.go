@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// insertClicks records clicks on urlID at the given times, formatted as dbTimeFormat
+func insertClicks(t *testing.T, app *App, urlID int64, times ...string) {
+	t.Helper()
+
+	for _, clickedAt := range times {
+		_, err := testDB(app).Exec("INSERT INTO clicks (url_id, clicked_at) VALUES (?, ?)", urlID, clickedAt)
+		if err != nil {
+			t.Fatalf("Failed to insert click: %v", err)
+		}
+	}
+}
+
+func TestGetTimeSeries(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	resp, err := app.createShortURL(context.Background(), &ShortenRequest{URL: "https://www.example.com/timeseries"})
+	if err != nil {
+		t.Fatalf("Failed to create short URL: %v", err)
+	}
+	record, err := app.getURL(context.Background(), resp.ShortCode)
+	if err != nil {
+		t.Fatalf("Failed to get URL: %v", err)
+	}
+
+	insertClicks(t, app, record.ID,
+		"2025-03-02 23:59:59", // Sunday, before the range
+		"2025-03-03 08:15:00", // Monday
+		"2025-03-03 08:45:00",
+		"2025-03-03 10:00:00",
+		"2025-03-05 12:00:00", // Wednesday
+		"2025-03-10 00:00:00", // next Monday
+		"2025-03-17 00:00:00", // after the range
+	)
+
+	from := time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		interval string
+		buckets  int
+		clicks   map[int]int64
+	}{
+		{"hour", 7*24 + 13, map[int]int64{8: 2, 10: 1, 2*24 + 12: 1, 7 * 24: 1}},
+		{"day", 8, map[int]int64{0: 3, 2: 1, 7: 1}},
+		{"week", 2, map[int]int64{0: 4, 1: 1}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.interval, func(t *testing.T) {
+			series, err := app.getTimeSeries(context.Background(), resp.ShortCode, tc.interval, from, to, false)
+			if err != nil {
+				t.Fatalf("Failed to get time series: %v", err)
+			}
+
+			if len(series.Buckets) != tc.buckets {
+				t.Fatalf("Expected %d buckets, got %d", tc.buckets, len(series.Buckets))
+			}
+
+			if !series.Buckets[0].Start.Equal(from) {
+				t.Errorf("Expected first bucket at %v, got %v", from, series.Buckets[0].Start)
+			}
+
+			for i, bucket := range series.Buckets {
+				if bucket.Clicks != tc.clicks[i] {
+					t.Errorf("Expected %d clicks in bucket %d (%v), got %d", tc.clicks[i], i, bucket.Start, bucket.Clicks)
+				}
+			}
+		})
+	}
+}
+
+func TestGetTimeSeries_Errors(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	now := time.Now()
+
+	if _, err := app.getTimeSeries(context.Background(), "nonexistent", "day", now.Add(-time.Hour), now, false); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got: %v", err)
+	}
+
+	if _, err := app.getTimeSeries(context.Background(), "nonexistent", "minute", now.Add(-time.Hour), now, false); err == nil {
+		t.Error("Expected error for unsupported interval, got nil")
+	}
+
+	if _, err := app.getTimeSeries(context.Background(), "nonexistent", "hour", now.AddDate(-1, 0, 0), now, false); err == nil {
+		t.Error("Expected error for too many buckets, got nil")
+	}
+}
+
+func TestHandleTimeSeries(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	resp, err := app.createShortURL(context.Background(), &ShortenRequest{URL: "https://www.example.com/timeseries-handler"})
+	if err != nil {
+		t.Fatalf("Failed to create short URL: %v", err)
+	}
+
+	mux := app.setupRoutes()
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/"+resp.ShortCode+"/stats/timeseries?interval=day&from=2025-01-01&to=2025-01-07", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	var series TimeSeries
+	if err := json.NewDecoder(rec.Body).Decode(&series); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if series.Interval != "day" || len(series.Buckets) != 7 {
+		t.Errorf("Expected 7 day buckets, got %d %s buckets", len(series.Buckets), series.Interval)
+	}
+
+	for _, query := range []string{"interval=month", "from=yesterday", "from=2025-01-07&to=2025-01-01"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", "/"+resp.ShortCode+"/stats/timeseries?"+query, nil))
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d for '%s', got %d", http.StatusBadRequest, query, rec.Code)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/nonexistent/stats/timeseries", nil))
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestGetBreakdown(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	resp, err := app.createShortURL(context.Background(), &ShortenRequest{URL: "https://www.example.com/breakdown"})
+	if err != nil {
+		t.Fatalf("Failed to create short URL: %v", err)
+	}
+	record, err := app.getURL(context.Background(), resp.ShortCode)
+	if err != nil {
+		t.Fatalf("Failed to get URL: %v", err)
+	}
+
+	firefox := "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0"
+	iphone := "Mozilla/5.0 (iPhone; CPU iPhone OS 17_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Mobile/15E148 Safari/604.1"
+	clicks := []struct{ userAgent, referer, clickedAt string }{
+		{firefox, "https://www.google.com/search", "2025-01-01 10:00:00"},
+		{firefox, "https://google.com/", "2025-01-02 10:00:00"},
+		{iphone, "https://t.co/abc", "2025-01-02 11:00:00"},
+		{iphone, "", "2025-01-03 10:00:00"},
+		{"curl/8.4.0", "", "2025-02-01 10:00:00"},
+	}
+	for _, click := range clicks {
+		_, err := testDB(app).Exec(
+			"INSERT INTO clicks (url_id, user_agent, referer, clicked_at) VALUES (?, ?, ?, ?)",
+			record.ID, click.userAgent, click.referer, click.clickedAt,
+		)
+		if err != nil {
+			t.Fatalf("Failed to insert click: %v", err)
+		}
+	}
+
+	breakdown, err := app.getBreakdown(context.Background(), resp.ShortCode, 2, nil, nil, false)
+	if err != nil {
+		t.Fatalf("Failed to get breakdown: %v", err)
+	}
+
+	if breakdown.TotalClicks != 5 {
+		t.Errorf("Expected 5 clicks, got %d", breakdown.TotalClicks)
+	}
+
+	expectedReferrers := []BreakdownEntry{{"(direct)", 2}, {"google.com", 2}}
+	if !reflect.DeepEqual(breakdown.Referrers, expectedReferrers) {
+		t.Errorf("Expected referrers %v, got %v", expectedReferrers, breakdown.Referrers)
+	}
+
+	expectedDevices := []BreakdownEntry{{DeviceDesktop, 2}, {DeviceMobile, 2}}
+	if !reflect.DeepEqual(breakdown.Devices, expectedDevices) {
+		t.Errorf("Expected devices %v, got %v", expectedDevices, breakdown.Devices)
+	}
+
+	from := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC)
+	breakdown, err = app.getBreakdown(context.Background(), resp.ShortCode, 10, &from, &to, false)
+	if err != nil {
+		t.Fatalf("Failed to get breakdown: %v", err)
+	}
+
+	expectedBrowsers := []BreakdownEntry{{"Firefox", 1}, {"Safari", 1}}
+	if breakdown.TotalClicks != 2 || !reflect.DeepEqual(breakdown.Browsers, expectedBrowsers) {
+		t.Errorf("Expected browsers %v in range, got %d clicks: %v", expectedBrowsers, breakdown.TotalClicks, breakdown.Browsers)
+	}
+}
+
+func TestHandleBreakdown(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	resp, err := app.createShortURL(context.Background(), &ShortenRequest{URL: "https://www.example.com/breakdown-handler"})
+	if err != nil {
+		t.Fatalf("Failed to create short URL: %v", err)
+	}
+
+	mux := app.setupRoutes()
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/"+resp.ShortCode+"/stats/breakdown?limit=5&from=2025-01-01", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	for _, query := range []string{"limit=0", "limit=abc", "to=tomorrow", "from=2025-01-07&to=2025-01-01"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", "/"+resp.ShortCode+"/stats/breakdown?"+query, nil))
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d for '%s', got %d", http.StatusBadRequest, query, rec.Code)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/nonexistent/stats/breakdown", nil))
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+}
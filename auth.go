@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiKeyPrefix makes keys easy to recognise in configs and secret scanners
+const apiKeyPrefix = "ul_"
+
+// ErrInvalidAPIKey is returned when a key is unknown or revoked
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// createPatterns are the routes that require an API key when Config.RequireAPIKey is set
+var createPatterns = map[string]bool{
+	"POST /s": true,
+	"GET /s":  true,
+}
+
+// managePatterns are the routes that change existing links or show their
+// history. They always require an API key, and only the key that created a
+// link may manage it.
+var managePatterns = map[string]bool{
+	"GET /{shortCode}/history":  true,
+	"PATCH /{shortCode}":        true,
+	"DELETE /{shortCode}":       true,
+	"POST /{shortCode}/disable": true,
+	"POST /{shortCode}/enable":  true,
+}
+
+// APIKey represents a key allowed to use the write endpoints
+type APIKey struct {
+	ID        int64      `json:"id"`
+	Name      string     `json:"name"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+type contextKey int
+
+const apiKeyContextKey contextKey = iota
+
+// apiKeyFromContext returns the API key that authenticated the request, if any
+func apiKeyFromContext(ctx context.Context) *APIKey {
+	key, _ := ctx.Value(apiKeyContextKey).(*APIKey)
+	return key
+}
+
+// hashAPIKey returns the hex SHA-256 of a key. Keys are random and long,
+// so a fast hash is enough and lets us look them up directly.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// createAPIKey generates and stores a new key, returning the plaintext key once
+func (a *App) createAPIKey(ctx context.Context, name string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("API key name cannot be empty")
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	key := apiKeyPrefix + hex.EncodeToString(secret)
+
+	err := a.store.CreateAPIKey(ctx, name, hashAPIKey(key))
+	if errors.Is(err, ErrAPIKeyExists) {
+		return "", fmt.Errorf("API key %q already exists", name)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return key, nil
+}
+
+// revokeAPIKey stops a key from authenticating
+func (a *App) revokeAPIKey(ctx context.Context, name string) error {
+	revoked, err := a.store.RevokeAPIKey(ctx, name, time.Now())
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return fmt.Errorf("no active API key named %q", name)
+	}
+
+	return nil
+}
+
+// listAPIKeys returns all keys, including revoked ones
+func (a *App) listAPIKeys(ctx context.Context) ([]APIKey, error) {
+	return a.store.ListAPIKeys(ctx)
+}
+
+// lookupAPIKey finds an active key by its plaintext value
+func (a *App) lookupAPIKey(ctx context.Context, key string) (*APIKey, error) {
+	defer a.metrics.observeQuery("lookup_api_key", time.Now())
+
+	return a.store.LookupAPIKey(ctx, hashAPIKey(key))
+}
+
+// runKeysCommand handles `ul keys create|revoke <name>` and `ul keys list`
+func (a *App) runKeysCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: ul keys create|revoke <name> | ul keys list")
+	}
+
+	ctx := context.Background()
+
+	switch {
+	case args[0] == "create" && len(args) == 2:
+		key, err := a.createAPIKey(ctx, args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Println(key)
+	case args[0] == "revoke" && len(args) == 2:
+		return a.revokeAPIKey(ctx, args[1])
+	case args[0] == "list" && len(args) == 1:
+		keys, err := a.listAPIKeys(ctx)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			status := "active"
+			if key.RevokedAt != nil {
+				status = "revoked " + key.RevokedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%s\t%s\t%s\n", key.Name, key.CreatedAt.Format(time.RFC3339), status)
+		}
+	default:
+		return fmt.Errorf("usage: ul keys create|revoke <name> | ul keys list")
+	}
+
+	return nil
+}
+
+// authMiddleware resolves "Authorization: Bearer" API keys on the routes in
+// createPatterns and managePatterns, rejecting unauthenticated management
+// requests, as well as unauthenticated shorten requests when
+// Config.RequireAPIKey is set. Other routes are public and ignore the header,
+// which may carry credentials meant for something else. mux is only used to
+// match requests against the patterns. Invalid keys count against the client
+// IP's budget of Config.RateLimitAuth.
+func (a *App) authMiddleware(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := loggerFromContext(r.Context())
+
+		_, pattern := mux.Handler(r)
+		if !createPatterns[pattern] && !managePatterns[pattern] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if a.isAdminRequest(r) {
+			// The admin token isn't an API key; the handlers it is meant for check it
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		header := r.Header.Get("Authorization")
+		if header != "" {
+			token, ok := strings.CutPrefix(header, "Bearer ")
+			if !ok {
+				logger.Warn("Malformed Authorization header", "path", r.URL.Path)
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeError(w, http.StatusUnauthorized, "Authorization header must use the Bearer scheme")
+				return
+			}
+
+			// Clients that keep sending bad keys are cut off before the lookup, so
+			// guessing keys is limited even though keyed requests have their own budget
+			client := "ip:" + clientIP(r, a.trustedProxies)
+			if wait := a.authFailures.wait(client, time.Now()); wait > 0 {
+				retryAfter := int(math.Ceil(wait.Seconds()))
+				logger.Warn("Too many invalid API keys", "client", client, "path", r.URL.Path, "retry_after", retryAfter)
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				writeError(w, http.StatusTooManyRequests, "Rate limit exceeded")
+				return
+			}
+
+			key, err := a.lookupAPIKey(r.Context(), strings.TrimSpace(token))
+			if errors.Is(err, ErrInvalidAPIKey) {
+				a.authFailures.allow(client, time.Now())
+				logger.Warn("API key rejected", "path", r.URL.Path)
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				writeError(w, http.StatusUnauthorized, "Invalid API key")
+				return
+			}
+			if err != nil {
+				logger.Error("Failed to look up API key", "error", err)
+				writeError(w, http.StatusInternalServerError, "Failed to verify API key")
+				return
+			}
+
+			r = r.WithContext(context.WithValue(r.Context(), apiKeyContextKey, key))
+		} else if managePatterns[pattern] || a.config.RequireAPIKey {
+			logger.Warn("API key required", "method", r.Method, "path", r.URL.Path)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "API key required")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authorizeLink reports whether the request may manage shortCode, writing an
+// error response if not. The admin token may manage any link, API keys only
+// the links they created. Links owned by other keys, or by no key, are
+// reported as not found so their existence isn't revealed.
+func (a *App) authorizeLink(w http.ResponseWriter, r *http.Request, shortCode string) bool {
+	logger := loggerFromContext(r.Context())
+
+	if a.isAdminRequest(r) {
+		return true
+	}
+
+	key := apiKeyFromContext(r.Context())
+	if key == nil {
+		logger.Warn("API key required", "method", r.Method, "path", r.URL.Path)
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, "API key required")
+		return false
+	}
+
+	record, err := a.getURL(r.Context(), shortCode)
+	if err == nil && (record.APIKeyID == nil || *record.APIKeyID != key.ID) {
+		logger.Warn("Short code not owned by API key", "short_code", shortCode, "api_key", key.Name)
+		err = ErrNotFound
+	}
+	if errors.Is(err, ErrNotFound) {
+		writeError(w, http.StatusNotFound, "Short code not found")
+		return false
+	}
+	if err != nil {
+		logger.Error("Failed to look up short code", "error", err, "short_code", shortCode)
+		writeError(w, http.StatusInternalServerError, "Failed to look up short code")
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	key, err := app.createAPIKey(context.Background(), "ci")
+	if err != nil {
+		t.Fatalf("Failed to create API key: %v", err)
+	}
+
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		t.Errorf("Expected key to start with '%s', got '%s'", apiKeyPrefix, key)
+	}
+
+	if _, err := app.createAPIKey(context.Background(), "ci"); err == nil {
+		t.Error("Expected error for duplicate key name, got nil")
+	}
+
+	apiKey, err := app.lookupAPIKey(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Failed to look up API key: %v", err)
+	}
+
+	if apiKey.Name != "ci" {
+		t.Errorf("Expected key name 'ci', got '%s'", apiKey.Name)
+	}
+
+	if _, err := app.lookupAPIKey(context.Background(), "ul_wrong"); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("Expected ErrInvalidAPIKey for unknown key, got: %v", err)
+	}
+
+	if err := app.revokeAPIKey(context.Background(), "ci"); err != nil {
+		t.Fatalf("Failed to revoke API key: %v", err)
+	}
+
+	if _, err := app.lookupAPIKey(context.Background(), key); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("Expected ErrInvalidAPIKey for revoked key, got: %v", err)
+	}
+
+	keys, err := app.listAPIKeys(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to list API keys: %v", err)
+	}
+
+	if len(keys) != 1 || keys[0].RevokedAt == nil {
+		t.Errorf("Expected one revoked key, got %+v", keys)
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	key, err := app.createAPIKey(context.Background(), "ci")
+	if err != nil {
+		t.Fatalf("Failed to create API key: %v", err)
+	}
+
+	mux := app.setupRoutes()
+	handler := app.authMiddleware(mux, mux)
+
+	shorten := func(url, authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/s", strings.NewReader(`{"url":"`+url+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Keys are optional unless required by config
+	if rec := shorten("https://www.example.com/open", ""); rec.Code != http.StatusCreated {
+		t.Errorf("Expected status %d without key, got %d", http.StatusCreated, rec.Code)
+	}
+
+	app.config.RequireAPIKey = true
+
+	testCases := []struct {
+		authorization string
+		expected      int
+		name          string
+	}{
+		{"", http.StatusUnauthorized, "missing key"},
+		{"Bearer ul_wrong", http.StatusUnauthorized, "invalid key"},
+		{"Basic " + key, http.StatusUnauthorized, "wrong scheme"},
+		{"Bearer " + key, http.StatusCreated, "valid key"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := shorten("https://www.example.com/"+strings.ReplaceAll(tc.name, " ", "-"), tc.authorization)
+			if rec.Code != tc.expected {
+				t.Errorf("Expected status %d, got %d", tc.expected, rec.Code)
+			}
+		})
+	}
+
+	// The creating key is recorded on the row
+	rec := shorten("https://www.example.com/owned", "Bearer "+key)
+	var resp ShortenResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	var keyName string
+	err = testDB(app).QueryRow(`
+		SELECT api_keys.name FROM urls JOIN api_keys ON api_keys.id = urls.api_key_id
+		WHERE urls.short_code = ?
+	`, resp.ShortCode).Scan(&keyName)
+	if err != nil || keyName != "ci" {
+		t.Errorf("Expected URL to be owned by key 'ci', got '%s' (%v)", keyName, err)
+	}
+
+	// Management always requires a key
+	app.config.RequireAPIKey = false
+	disableRec := httptest.NewRecorder()
+	handler.ServeHTTP(disableRec, httptest.NewRequest("POST", "/"+resp.ShortCode+"/disable", nil))
+
+	if disableRec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for disable without key, got %d", http.StatusUnauthorized, disableRec.Code)
+	}
+
+	// Reads stay open
+	redirectRec := httptest.NewRecorder()
+	handler.ServeHTTP(redirectRec, httptest.NewRequest("GET", "/"+resp.ShortCode, nil))
+
+	if redirectRec.Code != http.StatusMovedPermanently {
+		t.Errorf("Expected status %d for redirect without key, got %d", http.StatusMovedPermanently, redirectRec.Code)
+	}
+
+	// and ignore credentials meant for something else, such as a proxy in front
+	for _, authorization := range []string{"Basic dXNlcjpwYXNz", "Bearer ul_wrong"} {
+		req := httptest.NewRequest("GET", "/"+resp.ShortCode, nil)
+		req.Header.Set("Authorization", authorization)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusMovedPermanently {
+			t.Errorf("Expected status %d for redirect with '%s', got %d", http.StatusMovedPermanently, authorization, rec.Code)
+		}
+	}
+}
+
+func TestAuthMiddleware_AdminToken(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	key, err := app.createAPIKey(context.Background(), "ci")
+	if err != nil {
+		t.Fatalf("Failed to create API key: %v", err)
+	}
+
+	resp, err := app.createShortURL(context.Background(), &ShortenRequest{URL: "https://www.example.com/admin-only"})
+	if err != nil {
+		t.Fatalf("Failed to create short URL: %v", err)
+	}
+
+	mux := app.setupRoutes()
+	handler := app.authMiddleware(mux, mux)
+
+	testCases := []struct {
+		authorization string
+		expected      int
+		name          string
+	}{
+		{"Bearer " + key, http.StatusNotFound, "api key"},
+		{"Bearer " + testAdminToken, http.StatusOK, "admin token"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/"+resp.ShortCode+"/disable", nil)
+			req.Header.Set("Authorization", tc.authorization)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expected {
+				t.Errorf("Expected status %d, got %d", tc.expected, rec.Code)
+			}
+		})
+	}
+}
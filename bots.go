@@ -0,0 +1,55 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+	"strings"
+)
+
+//go:embed static/bots.txt
+var botSignaturesFile string
+
+// botSignatures are the lowercased user-agent substrings listed in static/bots.txt
+var botSignatures = parseBotSignatures(botSignaturesFile)
+
+// parseBotSignatures reads one signature per line, skipping blank lines and # comments
+func parseBotSignatures(file string) []string {
+	var signatures []string
+	for _, line := range strings.Split(file, "\n") {
+		line = strings.ToLower(strings.TrimSpace(line))
+		if line != "" && !strings.HasPrefix(line, "#") {
+			signatures = append(signatures, line)
+		}
+	}
+	return signatures
+}
+
+// isBotUserAgent reports whether a User-Agent header matches a known bot signature
+func isBotUserAgent(userAgent string) bool {
+	ua := strings.ToLower(userAgent)
+	for _, signature := range botSignatures {
+		if strings.Contains(ua, signature) {
+			return true
+		}
+	}
+	return false
+}
+
+// isBotRequest reports whether r comes from a crawler, link preview fetcher or
+// monitoring service rather than a person following the link. Besides the user
+// agent, HEAD requests and browser prefetches are counted as bots since nobody
+// ends up at the destination.
+func isBotRequest(r *http.Request) bool {
+	if r.Method == http.MethodHead {
+		return true
+	}
+
+	for _, header := range []string{"Purpose", "Sec-Purpose", "X-Purpose", "X-Moz"} {
+		value := strings.ToLower(r.Header.Get(header))
+		if strings.Contains(value, "prefetch") || strings.Contains(value, "preview") {
+			return true
+		}
+	}
+
+	return isBotUserAgent(r.Header.Get("User-Agent"))
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIsBotRequest(t *testing.T) {
+	chrome := "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+
+	testCases := []struct {
+		method   string
+		headers  map[string]string
+		expected bool
+		name     string
+	}{
+		{"GET", map[string]string{"User-Agent": chrome}, false, "browser"},
+		{"GET", map[string]string{}, false, "no user agent"},
+		{"GET", map[string]string{"User-Agent": "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)"}, true, "slack"},
+		{"GET", map[string]string{"User-Agent": "Mozilla/5.0 (compatible; Discordbot/2.0; +https://discordapp.com)"}, true, "discord"},
+		{"GET", map[string]string{"User-Agent": "Twitterbot/1.0"}, true, "twitter"},
+		{"GET", map[string]string{"User-Agent": "facebookexternalhit/1.1"}, true, "facebook"},
+		{"GET", map[string]string{"User-Agent": "Mozilla/5.0+(compatible; UptimeRobot/2.0; http://www.uptimerobot.com/)"}, true, "uptime monitor"},
+		{"HEAD", map[string]string{"User-Agent": chrome}, true, "head request"},
+		{"GET", map[string]string{"User-Agent": chrome, "Purpose": "prefetch"}, true, "purpose prefetch"},
+		{"GET", map[string]string{"User-Agent": chrome, "Sec-Purpose": "prefetch;prerender"}, true, "sec-purpose prefetch"},
+		{"GET", map[string]string{"User-Agent": chrome, "X-Purpose": "preview"}, true, "x-purpose preview"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/abc", nil)
+			for name, value := range tc.headers {
+				req.Header.Set(name, value)
+			}
+
+			if isBot := isBotRequest(req); isBot != tc.expected {
+				t.Errorf("Expected %v, got %v", tc.expected, isBot)
+			}
+		})
+	}
+}
+
+func TestParseBotSignatures(t *testing.T) {
+	signatures := parseBotSignatures("# comment\n\n  SlackBot \ncurl/\n")
+	if len(signatures) != 2 || signatures[0] != "slackbot" || signatures[1] != "curl/" {
+		t.Errorf("Expected [slackbot curl/], got %v", signatures)
+	}
+}
+
+func TestHandleRedirect_BotsExcludedFromClicks(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	resp, err := app.createShortURL(context.Background(), &ShortenRequest{URL: "https://www.example.com/invite", MaxClicks: 1})
+	if err != nil {
+		t.Fatalf("Failed to create short URL: %v", err)
+	}
+
+	// Link previews must not use up a one-time link
+	for _, userAgent := range []string{"Slackbot-LinkExpanding 1.0", "Twitterbot/1.0"} {
+		req := httptest.NewRequest("GET", "/"+resp.ShortCode, nil)
+		req.Header.Set("User-Agent", userAgent)
+		rec := httptest.NewRecorder()
+		app.handleRedirect(rec, req)
+
+		if rec.Code != http.StatusOK || rec.Header().Get("Location") != "" {
+			t.Errorf("Expected a preview for %s, got %d to '%s'", userAgent, rec.Code, rec.Header().Get("Location"))
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/"+resp.ShortCode, nil)
+	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0")
+	rec := httptest.NewRecorder()
+	app.handleRedirect(rec, req)
+
+	if rec.Code != http.StatusFound {
+		t.Fatalf("Expected status %d for a person, got %d", http.StatusFound, rec.Code)
+	}
+
+	stats, err := app.getStats(context.Background(), resp.ShortCode)
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+
+	if stats.TotalClicks != 1 || stats.BotClicks != 2 {
+		t.Errorf("Expected 1 click and 2 bot clicks, got %d and %d", stats.TotalClicks, stats.BotClicks)
+	}
+
+	var bots int
+	if err := testDB(app).QueryRow("SELECT COUNT(*) FROM clicks WHERE is_bot = 1").Scan(&bots); err != nil {
+		t.Fatalf("Failed to count bot clicks: %v", err)
+	}
+	if bots < 2 {
+		t.Errorf("Expected bot clicks to be recorded, found %d", bots)
+	}
+
+	// Once the link is used up, bots are refused too
+	req = httptest.NewRequest("GET", "/"+resp.ShortCode, nil)
+	req.Header.Set("User-Agent", "Slackbot-LinkExpanding 1.0")
+	rec = httptest.NewRecorder()
+	app.handleRedirect(rec, req)
+
+	if rec.Code != http.StatusGone {
+		t.Errorf("Expected status %d, got %d", http.StatusGone, rec.Code)
+	}
+
+	for query, expected := range map[string]int64{"": 1, "?include_bots=true": 3} {
+		rec := httptest.NewRecorder()
+		app.handleStats(rec, httptest.NewRequest("GET", "/"+resp.ShortCode+"/stats"+query, nil))
+
+		var stats URLStats
+		if err := json.NewDecoder(rec.Body).Decode(&stats); err != nil {
+			t.Fatalf("Failed to decode stats: %v", err)
+		}
+		if stats.TotalClicks != expected {
+			t.Errorf("Expected %d total clicks for '%s', got %d", expected, query, stats.TotalClicks)
+		}
+	}
+}
+
+func TestHandleRedirect_LimitedLinkHiddenFromBots(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	resp, err := app.createShortURL(context.Background(), &ShortenRequest{URL: "https://www.example.com/secret-invite", MaxClicks: 1})
+	if err != nil {
+		t.Fatalf("Failed to create short URL: %v", err)
+	}
+
+	testCases := []struct {
+		method string
+		header string
+		value  string
+		name   string
+	}{
+		{"HEAD", "User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0", "head"},
+		{"GET", "Sec-Purpose", "prefetch", "prefetch"},
+		{"GET", "User-Agent", "Discordbot/2.0", "bot"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/"+resp.ShortCode, nil)
+			req.Header.Set(tc.header, tc.value)
+			rec := httptest.NewRecorder()
+			app.handleRedirect(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Errorf("Expected status %d, got %d", http.StatusOK, rec.Code)
+			}
+			if location := rec.Header().Get("Location"); location != "" {
+				t.Errorf("Expected no Location header, got '%s'", location)
+			}
+			if strings.Contains(rec.Body.String(), "secret-invite") {
+				t.Errorf("Expected the destination to be hidden, got body '%s'", rec.Body.String())
+			}
+		})
+	}
+
+	// The link is still there for a person
+	rec := httptest.NewRecorder()
+	app.handleRedirect(rec, httptest.NewRequest("GET", "/"+resp.ShortCode, nil))
+
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "https://www.example.com/secret-invite" {
+		t.Errorf("Expected a redirect, got %d to '%s'", rec.Code, rec.Header().Get("Location"))
+	}
+}
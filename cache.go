@@ -0,0 +1,199 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// URLCacheStats reports the hit rate and size of the URL cache for monitoring
+type URLCacheStats struct {
+	Size      int   `json:"size"`
+	Capacity  int   `json:"capacity"`
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+}
+
+// urlCacheEntry is a cached lookup of one short code. A nil record caches
+// the short code not existing.
+type urlCacheEntry struct {
+	shortCode string
+	record    *URLRecord
+	expires   time.Time
+}
+
+// urlCache is a bounded LRU cache of short code lookups in front of the
+// database. Entries expire after a TTL so edits made by other replicas are
+// picked up, and are invalidated right away when changed through this one.
+// A nil *urlCache caches nothing.
+type urlCache struct {
+	mu          sync.Mutex
+	entries     map[string]*list.Element
+	order       *list.List
+	capacity    int
+	ttl         time.Duration
+	negativeTTL time.Duration
+	now         func() time.Time
+
+	// generation is bumped by every invalidation so that lookups which raced
+	// with a change don't store what they read before it
+	generation uint64
+
+	hits      atomic.Int64
+	misses    atomic.Int64
+	evictions atomic.Int64
+}
+
+// newURLCache creates a cache of up to capacity short codes, or returns nil
+// if capacity or ttl isn't positive
+func newURLCache(capacity int, ttl, negativeTTL time.Duration) *urlCache {
+	if capacity <= 0 || ttl <= 0 {
+		return nil
+	}
+
+	return &urlCache{
+		entries:     make(map[string]*list.Element),
+		order:       list.New(),
+		capacity:    capacity,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		now:         time.Now,
+	}
+}
+
+// get returns a copy of the cached record for shortCode, which is nil if the
+// short code is cached as unknown, and ok=false on a miss. The generation it
+// returns must be passed to put when caching the result of the miss.
+func (c *urlCache) get(shortCode string) (record *URLRecord, generation uint64, ok bool) {
+	if c == nil {
+		return nil, 0, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, found := c.entries[shortCode]
+	if found {
+		entry := element.Value.(*urlCacheEntry)
+		if c.now().Before(entry.expires) {
+			c.order.MoveToFront(element)
+			c.hits.Add(1)
+			if entry.record == nil {
+				return nil, c.generation, true
+			}
+			copied := *entry.record
+			return &copied, c.generation, true
+		}
+		c.remove(element)
+	}
+
+	c.misses.Add(1)
+	return nil, c.generation, false
+}
+
+// put caches record for shortCode, or caches it as unknown if record is nil,
+// unless an invalidation happened since generation was returned by get
+func (c *urlCache) put(shortCode string, record *URLRecord, generation uint64) {
+	if c == nil {
+		return
+	}
+
+	ttl := c.ttl
+	if record == nil {
+		ttl = c.negativeTTL
+		if ttl <= 0 {
+			return
+		}
+	} else {
+		copied := *record
+		record = &copied
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	if element, found := c.entries[shortCode]; found {
+		c.remove(element)
+	}
+
+	c.entries[shortCode] = c.order.PushFront(&urlCacheEntry{
+		shortCode: shortCode,
+		record:    record,
+		expires:   c.now().Add(ttl),
+	})
+
+	for c.order.Len() > c.capacity {
+		c.remove(c.order.Back())
+		c.evictions.Add(1)
+	}
+}
+
+// invalidate drops shortCode from the cache
+func (c *urlCache) invalidate(shortCode string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	if element, found := c.entries[shortCode]; found {
+		c.remove(element)
+	}
+}
+
+// remove deletes an element; c.mu must be held
+func (c *urlCache) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*urlCacheEntry).shortCode)
+}
+
+// Stats returns the cache's counters, or nil if caching is disabled
+func (c *urlCache) Stats() *URLCacheStats {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	size := c.order.Len()
+	c.mu.Unlock()
+
+	return &URLCacheStats{
+		Size:      size,
+		Capacity:  c.capacity,
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+	}
+}
+
+// lookupURL is getURL for the redirect path, served from the URL cache when
+// possible. Click-limited links aren't cached since their click count changes
+// with every redirect and is checked against the database anyway.
+func (a *App) lookupURL(ctx context.Context, shortCode string) (*URLRecord, error) {
+	record, generation, ok := a.urls.get(shortCode)
+	if ok {
+		if record == nil {
+			return nil, ErrNotFound
+		}
+		return record, nil
+	}
+
+	record, err := a.getURL(ctx, shortCode)
+	switch {
+	case err == ErrNotFound:
+		a.urls.put(shortCode, nil, generation)
+	case err == nil && record.MaxClicks == nil:
+		a.urls.put(shortCode, record, generation)
+	}
+
+	return record, err
+}
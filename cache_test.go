@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestURLCache(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	cache := newURLCache(2, time.Minute, 10*time.Second)
+	cache.now = func() time.Time { return now }
+
+	put := func(shortCode string, record *URLRecord) {
+		_, generation, _ := cache.get(shortCode)
+		cache.put(shortCode, record, generation)
+	}
+
+	put("a", &URLRecord{ShortCode: "a", OriginalURL: "https://a.example.com"})
+	put("b", &URLRecord{ShortCode: "b", OriginalURL: "https://b.example.com"})
+	put("missing", nil)
+
+	// Adding a third entry evicts the least recently used one
+	if _, _, ok := cache.get("a"); ok {
+		t.Error("Expected a to be evicted")
+	}
+	if record, _, ok := cache.get("b"); !ok || record.OriginalURL != "https://b.example.com" {
+		t.Errorf("Expected b to be cached, got %v (%v)", record, ok)
+	}
+	if record, _, ok := cache.get("missing"); !ok || record != nil {
+		t.Errorf("Expected missing to be cached as unknown, got %v (%v)", record, ok)
+	}
+
+	// Unknown short codes expire sooner than known ones
+	now = now.Add(30 * time.Second)
+	if _, _, ok := cache.get("missing"); ok {
+		t.Error("Expected negative entry to expire")
+	}
+	if _, _, ok := cache.get("b"); !ok {
+		t.Error("Expected b to still be cached")
+	}
+	now = now.Add(time.Minute)
+	if _, _, ok := cache.get("b"); ok {
+		t.Error("Expected b to expire")
+	}
+
+	// Lookups that raced with an invalidation aren't cached
+	_, generation, _ := cache.get("c")
+	cache.invalidate("c")
+	cache.put("c", &URLRecord{ShortCode: "c"}, generation)
+	if _, _, ok := cache.get("c"); ok {
+		t.Error("Expected stale lookup not to be cached")
+	}
+
+	stats := cache.Stats()
+	if stats.Hits != 3 || stats.Misses != 8 || stats.Evictions != 1 || stats.Size != 0 || stats.Capacity != 2 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	if newURLCache(0, time.Minute, time.Second) != nil {
+		t.Error("Expected a size of 0 to disable the cache")
+	}
+}
+
+func TestLookupURL_Invalidation(t *testing.T) {
+	cfg := &Config{
+		DatabaseURL:         "file::memory:?cache=shared",
+		Port:                "7000",
+		BaseURL:             "http://localhost:7000",
+		URLCacheSize:        100,
+		URLCacheTTL:         time.Hour,
+		URLCacheNegativeTTL: time.Hour,
+	}
+
+	app, err := NewApp(context.Background(), cfg, WithResolver(publicResolver{}))
+	if err != nil {
+		t.Fatalf("Failed to create app: %v", err)
+	}
+	defer app.store.Close()
+
+	redirect := func(shortCode string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		app.handleRedirect(rec, httptest.NewRequest("GET", "/"+shortCode, nil))
+		return rec
+	}
+
+	// Unknown aliases are cached until they are created
+	if rec := redirect("cached-alias"); rec.Code != http.StatusNotFound {
+		t.Fatalf("Expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+	if _, err := app.createShortURL(context.Background(), &ShortenRequest{URL: "https://www.example.com/first", Alias: "cached-alias"}); err != nil {
+		t.Fatalf("Failed to create short URL: %v", err)
+	}
+	if rec := redirect("cached-alias"); rec.Header().Get("Location") != "https://www.example.com/first" {
+		t.Fatalf("Expected redirect to the new link, got %d %s", rec.Code, rec.Header().Get("Location"))
+	}
+	redirect("cached-alias")
+
+	if _, err := app.updateURL(context.Background(), "cached-alias", &UpdateRequest{URL: "https://www.example.com/second"}); err != nil {
+		t.Fatalf("Failed to update URL: %v", err)
+	}
+	if rec := redirect("cached-alias"); rec.Header().Get("Location") != "https://www.example.com/second" {
+		t.Errorf("Expected redirect to the updated destination, got %s", rec.Header().Get("Location"))
+	}
+
+	if err := app.setDisabled(context.Background(), "cached-alias", true); err != nil {
+		t.Fatalf("Failed to disable URL: %v", err)
+	}
+	if rec := redirect("cached-alias"); rec.Code != http.StatusGone {
+		t.Errorf("Expected status %d after disabling, got %d", http.StatusGone, rec.Code)
+	}
+
+	if err := app.deleteURL(context.Background(), "cached-alias"); err != nil {
+		t.Fatalf("Failed to delete URL: %v", err)
+	}
+	if rec := redirect("cached-alias"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d after deleting, got %d", http.StatusNotFound, rec.Code)
+	}
+
+	rec := httptest.NewRecorder()
+	app.setupRoutes().ServeHTTP(rec, httptest.NewRequest("GET", "/health", nil))
+
+	var health HealthResponse
+	if err := json.NewDecoder(rec.Body).Decode(&health); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if health.URLCache == nil || health.URLCache.Hits != 1 || health.URLCache.Misses != 5 {
+		t.Errorf("Expected 1 hit and 5 misses on /health, got %+v", health.URLCache)
+	}
+}
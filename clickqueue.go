@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Defaults used when the click queue settings in Config are not positive
+const (
+	defaultClickQueueSize     = 10000
+	defaultClickBatchSize     = 500
+	defaultClickFlushInterval = time.Second
+)
+
+// ClickQueueStats reports the state of the click queue for monitoring
+type ClickQueueStats struct {
+	Depth    int   `json:"depth"`
+	Capacity int   `json:"capacity"`
+	Enqueued int64 `json:"enqueued"`
+	Dropped  int64 `json:"dropped"`
+	Written  int64 `json:"written"`
+	Failed   int64 `json:"failed"`
+	Batches  int64 `json:"batches"`
+}
+
+// clickQueue buffers clicks in a bounded channel and writes them in batches
+// from a single background goroutine, one transaction per flush. When the
+// queue is full new clicks are dropped rather than slowing down redirects.
+type clickQueue struct {
+	app           *App
+	clicks        chan *Click
+	batchSize     int
+	flushInterval time.Duration
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+
+	enqueued atomic.Int64
+	dropped  atomic.Int64
+	written  atomic.Int64
+	failed   atomic.Int64
+	batches  atomic.Int64
+}
+
+// newClickQueue creates a queue writing to a's database and starts its writer
+func newClickQueue(a *App, size, batchSize int, flushInterval time.Duration) *clickQueue {
+	if size <= 0 {
+		size = defaultClickQueueSize
+	}
+	if batchSize <= 0 {
+		batchSize = defaultClickBatchSize
+	}
+	if flushInterval <= 0 {
+		flushInterval = defaultClickFlushInterval
+	}
+
+	q := &clickQueue{
+		app:           a,
+		clicks:        make(chan *Click, size),
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	go q.run()
+
+	return q
+}
+
+// Enqueue queues a click for writing, reporting false if it was dropped
+func (q *clickQueue) Enqueue(click *Click) bool {
+	select {
+	case q.clicks <- click:
+		q.enqueued.Add(1)
+		return true
+	default:
+		q.dropped.Add(1)
+		return false
+	}
+}
+
+// Stats returns the current queue depth and counters
+func (q *clickQueue) Stats() ClickQueueStats {
+	return ClickQueueStats{
+		Depth:    len(q.clicks),
+		Capacity: cap(q.clicks),
+		Enqueued: q.enqueued.Load(),
+		Dropped:  q.dropped.Load(),
+		Written:  q.written.Load(),
+		Failed:   q.failed.Load(),
+		Batches:  q.batches.Load(),
+	}
+}
+
+// Close stops the writer after flushing the clicks already queued, waiting
+// until that's done or ctx expires. It must only be called once no more
+// clicks are being enqueued, i.e. after the HTTP server has shut down.
+func (q *clickQueue) Close(ctx context.Context) error {
+	q.stopOnce.Do(func() { close(q.stop) })
+
+	select {
+	case <-q.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("click queue not drained, %d clicks pending: %w", len(q.clicks), ctx.Err())
+	}
+}
+
+// run collects clicks into batches, flushing when a batch is full, when the
+// flush interval passes and when the queue is closed
+func (q *clickQueue) run() {
+	defer close(q.done)
+
+	ticker := time.NewTicker(q.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Click, 0, q.batchSize)
+	add := func(click *Click) {
+		batch = append(batch, click)
+		if len(batch) >= q.batchSize {
+			q.flush(batch)
+			batch = batch[:0]
+		}
+	}
+
+	for {
+		select {
+		case click := <-q.clicks:
+			add(click)
+		case <-ticker.C:
+			if len(batch) > 0 {
+				q.flush(batch)
+				batch = batch[:0]
+			}
+		case <-q.stop:
+			for {
+				select {
+				case click := <-q.clicks:
+					add(click)
+				default:
+					if len(batch) > 0 {
+						q.flush(batch)
+					}
+					return
+				}
+			}
+		}
+	}
+}
+
+// flush writes a batch, counting its clicks as written or failed
+func (q *clickQueue) flush(batch []*Click) {
+	q.batches.Add(1)
+
+	if err := q.app.writeClicks(context.Background(), batch); err != nil {
+		q.failed.Add(int64(len(batch)))
+		log.Error("Failed to write clicks", "error", err, "clicks", len(batch))
+		return
+	}
+
+	q.written.Add(int64(len(batch)))
+}
+
+// writeClicks records a batch of clicks. Click limits aren't enforced here,
+// so clicks on click-limited links must go through trackClick instead.
+func (a *App) writeClicks(ctx context.Context, batch []*Click) error {
+	defer a.metrics.observeQuery("write_clicks", time.Now())
+
+	return a.store.WriteClicks(ctx, batch)
+}
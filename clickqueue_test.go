@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClickQueue_WritesBatches(t *testing.T) {
+	cfg := &Config{
+		DatabaseURL:        "file::memory:?cache=shared",
+		Port:               "7000",
+		BaseURL:            "http://localhost:7000",
+		ClickBatchSize:     3,
+		ClickFlushInterval: time.Hour,
+	}
+
+	app, err := NewApp(context.Background(), cfg, WithResolver(publicResolver{}))
+	if err != nil {
+		t.Fatalf("Failed to create app: %v", err)
+	}
+	defer app.store.Close()
+
+	first, err := app.createShortURL(context.Background(), &ShortenRequest{URL: "https://www.example.com/queued-1"})
+	if err != nil {
+		t.Fatalf("Failed to create short URL: %v", err)
+	}
+	second, err := app.createShortURL(context.Background(), &ShortenRequest{URL: "https://www.example.com/queued-2"})
+	if err != nil {
+		t.Fatalf("Failed to create short URL: %v", err)
+	}
+
+	// Clicks are written when they are redirected, not when they are flushed
+	clickedAt := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, code := range []string{first.ShortCode, first.ShortCode, first.ShortCode, second.ShortCode} {
+		req := httptest.NewRequest("GET", "/"+code, nil)
+		req.Header.Set("User-Agent", "Test-Agent")
+		app.handleRedirect(httptest.NewRecorder(), req)
+	}
+	app.clicks.Enqueue(&Click{URLID: mustGetURL(t, app, first.ShortCode).ID, IsBot: true, Time: clickedAt})
+
+	if err := app.clicks.Close(context.Background()); err != nil {
+		t.Fatalf("Failed to drain click queue: %v", err)
+	}
+
+	stats := app.clicks.Stats()
+	if stats.Written != 5 || stats.Dropped != 0 || stats.Failed != 0 || stats.Depth != 0 {
+		t.Errorf("Expected 5 clicks written, got %+v", stats)
+	}
+	// One full batch of 3, then the rest when draining
+	if stats.Batches != 2 {
+		t.Errorf("Expected 2 batches, got %d", stats.Batches)
+	}
+
+	for code, expected := range map[string]int64{first.ShortCode: 3, second.ShortCode: 1} {
+		record := mustGetURL(t, app, code)
+		if record.Clicks != expected || record.LastClickedAt == nil {
+			t.Errorf("Expected %d clicks with last_clicked_at for %s, got %d (%v)", expected, code, record.Clicks, record.LastClickedAt)
+		}
+	}
+
+	urlStats, err := app.getStats(context.Background(), first.ShortCode)
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if urlStats.BotClicks != 1 {
+		t.Errorf("Expected 1 bot click, got %d", urlStats.BotClicks)
+	}
+
+	var rows int
+	err = testDB(app).QueryRow("SELECT COUNT(*) FROM clicks WHERE url_id = ? AND clicked_at = ?",
+		mustGetURL(t, app, first.ShortCode).ID, clickedAt.Format(dbTimeFormat)).Scan(&rows)
+	if err != nil || rows != 1 {
+		t.Errorf("Expected the queued click to keep its time, got %d rows (%v)", rows, err)
+	}
+}
+
+func TestClickQueue_DropsWhenFull(t *testing.T) {
+	// Without a writer nothing is taken off the queue
+	q := &clickQueue{clicks: make(chan *Click, 2)}
+
+	for i, expected := range []bool{true, true, false} {
+		if queued := q.Enqueue(&Click{URLID: 1}); queued != expected {
+			t.Errorf("Click %d: expected queued=%v, got %v", i+1, expected, queued)
+		}
+	}
+
+	stats := q.Stats()
+	if stats.Depth != 2 || stats.Capacity != 2 || stats.Enqueued != 2 || stats.Dropped != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func mustGetURL(t *testing.T, app *App, shortCode string) *URLRecord {
+	t.Helper()
+
+	record, err := app.getURL(context.Background(), shortCode)
+	if err != nil {
+		t.Fatalf("Failed to get URL: %v", err)
+	}
+	return record
+}
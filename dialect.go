@@ -0,0 +1,141 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sqlDialect describes how a SQL database differs from the SQLite flavour the
+// queries in sqlStore are written in
+type sqlDialect struct {
+	name   string
+	driver string
+
+	// numberedParams rewrites ? placeholders to $1, $2, ...
+	numberedParams bool
+
+	// textTimes stores times as text in the CURRENT_TIMESTAMP layout, so that
+	// they compare as strings
+	textTimes bool
+
+	// reserveID returns the next URL ID, so short codes can be generated
+	// before inserting. IDs are never reused, but concurrent callers may be
+	// given the same one where the database has no sequences.
+	reserveID string
+
+	// buckets give the start of a click's timeSeriesIntervals bucket,
+	// formatted as dbTimeFormat
+	buckets map[string]string
+
+	// clickDay gives the UTC day of a click as YYYY-MM-DD
+	clickDay string
+
+	// latestClick keeps the later of last_clicked_at and a click time parameter
+	latestClick string
+
+	// migrationTables creates the tables used to track and lock migrations
+	migrationTables string
+
+	migrations []migration
+}
+
+var sqliteDialect = &sqlDialect{
+	name:      "sqlite",
+	driver:    "libsql",
+	textTimes: true,
+	reserveID: "SELECT COALESCE(MAX(seq), 0) + 1 FROM sqlite_sequence WHERE name = 'urls'",
+	buckets: map[string]string{
+		"hour": "strftime('%Y-%m-%d %H:00:00', clicked_at)",
+		"day":  "strftime('%Y-%m-%d 00:00:00', clicked_at)",
+		"week": "strftime('%Y-%m-%d 00:00:00', clicked_at, '-6 days', 'weekday 1')",
+	},
+	clickDay:    "strftime('%Y-%m-%d', clicked_at)",
+	latestClick: "MAX(COALESCE(last_clicked_at, ''), ?)",
+	migrationTables: `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS schema_migrations_lock (
+			id INTEGER PRIMARY KEY CHECK (id = 1),
+			owner TEXT NOT NULL,
+			locked_at DATETIME NOT NULL
+		);
+	`,
+	migrations: loadEmbeddedMigrations("sqlite"),
+}
+
+var postgresDialect = &sqlDialect{
+	name:           "postgres",
+	driver:         "pgx",
+	numberedParams: true,
+	reserveID:      "SELECT nextval(pg_get_serial_sequence('urls', 'id'))",
+	buckets: map[string]string{
+		"hour": "to_char(date_trunc('hour', clicked_at), 'YYYY-MM-DD HH24:MI:SS')",
+		"day":  "to_char(date_trunc('day', clicked_at), 'YYYY-MM-DD HH24:MI:SS')",
+		"week": "to_char(date_trunc('week', clicked_at), 'YYYY-MM-DD HH24:MI:SS')",
+	},
+	clickDay:    "to_char(clicked_at, 'YYYY-MM-DD')",
+	latestClick: "GREATEST(last_clicked_at, ?)",
+	migrationTables: `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP(0) NOT NULL DEFAULT (now() AT TIME ZONE 'UTC')
+		);
+
+		CREATE TABLE IF NOT EXISTS schema_migrations_lock (
+			id INTEGER PRIMARY KEY CHECK (id = 1),
+			owner TEXT NOT NULL,
+			locked_at TIMESTAMP(0) NOT NULL
+		);
+	`,
+	migrations: loadEmbeddedMigrations("postgres"),
+}
+
+// rebind rewrites the ? placeholders of query for the dialect
+func (d *sqlDialect) rebind(query string) string {
+	if !d.numberedParams {
+		return query
+	}
+
+	var b strings.Builder
+	param := 0
+	quoted := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'':
+			quoted = !quoted
+		case c == '?' && !quoted:
+			param++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(param))
+			continue
+		}
+		b.WriteByte(c)
+	}
+
+	return b.String()
+}
+
+// timeArg converts t to a parameter for a timestamp column, with the second
+// precision of CURRENT_TIMESTAMP
+func (d *sqlDialect) timeArg(t time.Time) any {
+	t = t.UTC().Truncate(time.Second)
+	if d.textTimes {
+		return t.Format(dbTimeFormat)
+	}
+	return t
+}
+
+// nullableTime converts an optional time to a parameter for a timestamp column
+func (d *sqlDialect) nullableTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return d.timeArg(*t)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSQLDialect_Rebind(t *testing.T) {
+	query := "SELECT * FROM urls WHERE short_code = ? AND password_hash <> '?' AND id IN (?, ?)"
+
+	if got := sqliteDialect.rebind(query); got != query {
+		t.Errorf("Expected SQLite queries to be unchanged, got %q", got)
+	}
+
+	want := "SELECT * FROM urls WHERE short_code = $1 AND password_hash <> '?' AND id IN ($2, $3)"
+	if got := postgresDialect.rebind(query); got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestSQLDialect_TimeArg(t *testing.T) {
+	at := time.Date(2024, 3, 1, 12, 30, 45, 500, time.FixedZone("CET", 3600))
+
+	if got := sqliteDialect.timeArg(at); got != "2024-03-01 11:30:45" {
+		t.Errorf("Expected a UTC timestamp string, got %v", got)
+	}
+
+	want := time.Date(2024, 3, 1, 11, 30, 45, 0, time.UTC)
+	if got, ok := postgresDialect.timeArg(at).(time.Time); !ok || !got.Equal(want) || got.Location() != time.UTC {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	if got := postgresDialect.nullableTime(nil); got != nil {
+		t.Errorf("Expected nil, got %v", got)
+	}
+}
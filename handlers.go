@@ -1,10 +1,14 @@
 package main
 
 import (
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/skip2/go-qrcode"
 )
@@ -12,6 +16,7 @@ import (
 // ErrorResponse represents an error response
 type ErrorResponse struct {
 	Error string `json:"error"`
+	Code  string `json:"code,omitempty"`
 }
 
 // writeJSON writes a JSON response
@@ -26,60 +31,92 @@ func writeError(w http.ResponseWriter, status int, message string) {
 	writeJSON(w, status, ErrorResponse{Error: message})
 }
 
+// isAdminRequest reports whether r carries "Authorization: Bearer" with the
+// token from Config.AdminToken
+func (a *App) isAdminRequest(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && a.config.AdminToken != "" &&
+		subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), []byte(a.config.AdminToken)) == 1
+}
+
+// writeShortenError writes the error response for a failed createShortURL or updateURL
+func writeShortenError(w http.ResponseWriter, err error) {
+	var policyErr *PolicyError
+	switch {
+	case errors.As(err, &policyErr):
+		writeJSON(w, http.StatusForbidden, ErrorResponse{Error: err.Error(), Code: policyErr.Code})
+	case errors.Is(err, ErrAliasConflict):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		writeError(w, http.StatusBadRequest, err.Error())
+	}
+}
+
 // handleShorten handles POST /s - creates a shortened URL
 func (a *App) handleShorten(w http.ResponseWriter, r *http.Request) {
-	log.Info("Shorten URL requested", "method", r.Method, "path", r.URL.Path)
+	logger := loggerFromContext(r.Context())
+
 	var req ShortenRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Error("Invalid request body", "error", err, "method", r.Method)
+		logger.Error("Invalid request body", "error", err, "method", r.Method)
 		writeError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
-	resp, err := a.createShortURL(&req)
+	if key := apiKeyFromContext(r.Context()); key != nil {
+		req.APIKeyID = key.ID
+	}
+
+	resp, err := a.createShortURL(r.Context(), &req)
 	if err != nil {
-		log.Error("Failed to create short URL", "error", err, "url", req.URL)
-		writeError(w, http.StatusBadRequest, err.Error())
+		logger.Error("Failed to create short URL", "error", err, "url", req.URL)
+		writeShortenError(w, err)
 		return
 	}
 
-	log.Info("URL shortened", "original", req.URL, "short_code", resp.ShortCode)
+	logger.Info("URL shortened", "original", req.URL, "short_code", resp.ShortCode)
 	writeJSON(w, http.StatusCreated, resp)
 }
 
 // handleShortenGET handles GET /s?u=URL - creates a shortened URL via query parameter
 func (a *App) handleShortenGET(w http.ResponseWriter, r *http.Request) {
-	log.Info("Shorten URL requested (GET)", "method", r.Method, "path", r.URL.Path)
+	logger := loggerFromContext(r.Context())
 
 	// Get URL from query parameter
 	urlParam := r.URL.Query().Get("u")
 	if urlParam == "" {
-		log.Error("Missing URL query parameter", "method", r.Method)
+		logger.Error("Missing URL query parameter", "method", r.Method)
 		writeError(w, http.StatusBadRequest, "Missing 'u' query parameter")
 		return
 	}
 
 	req := &ShortenRequest{URL: urlParam}
-	resp, err := a.createShortURL(req)
+	if key := apiKeyFromContext(r.Context()); key != nil {
+		req.APIKeyID = key.ID
+	}
+	resp, err := a.createShortURL(r.Context(), req)
 	if err != nil {
-		log.Error("Failed to create short URL", "error", err, "url", req.URL)
-		writeError(w, http.StatusBadRequest, err.Error())
+		logger.Error("Failed to create short URL", "error", err, "url", req.URL)
+		writeShortenError(w, err)
 		return
 	}
 
-	log.Info("URL shortened", "original", req.URL, "short_code", resp.ShortCode)
+	logger.Info("URL shortened", "original", req.URL, "short_code", resp.ShortCode)
 	writeJSON(w, http.StatusCreated, resp)
 }
 
 // handleRedirect handles GET /{shortened} - redirects to original URL
 func (a *App) handleRedirect(w http.ResponseWriter, r *http.Request) {
-	log.Info("Redirect requested", "method", r.Method, "path", r.URL.Path)
+	logger := loggerFromContext(r.Context())
+
 	shortCode := strings.TrimPrefix(r.URL.Path, "/")
 
 	// Filter out special endpoints
-	if shortCode == "" || shortCode == "health" || strings.HasSuffix(shortCode, "/stats") || strings.HasSuffix(shortCode, "/qr") {
-		log.Info("Special endpoint filtered", "path", r.URL.Path)
+	if shortCode == "" || shortCode == "health" || shortCode == "livez" || shortCode == "readyz" ||
+		shortCode == "metrics" || strings.HasSuffix(shortCode, "/stats") ||
+		strings.HasSuffix(shortCode, "/qr") || strings.HasSuffix(shortCode, "/history") {
+		logger.Info("Special endpoint filtered", "path", r.URL.Path)
 		http.NotFound(w, r)
 		return
 	}
@@ -87,66 +124,354 @@ func (a *App) handleRedirect(w http.ResponseWriter, r *http.Request) {
 	// Remove trailing slash if present
 	shortCode = strings.TrimSuffix(shortCode, "/")
 
-	record, err := a.getURL(shortCode)
+	record, err := a.lookupURL(r.Context(), shortCode)
 	if err != nil {
-		log.Warn("Short code not found", "short_code", shortCode, "error", err)
+		logger.Warn("Short code not found", "short_code", shortCode, "error", err)
+		a.metrics.redirect(outcomeNotFound)
+		http.NotFound(w, r)
+		return
+	}
+
+	if !a.linkAvailable(w, r, record) {
+		return
+	}
+
+	if record.PasswordHash != "" {
+		logger.Info("Password required", "short_code", shortCode)
+		a.metrics.redirect(outcomePasswordRequired)
+		renderUnlockForm(w, http.StatusOK, shortCode, "")
+		return
+	}
+
+	// Links that can stop working must not be cached permanently by clients
+	status := http.StatusMovedPermanently
+	if record.ExpiresAt != nil || record.MaxClicks != nil {
+		status = http.StatusFound
+	}
+
+	a.followLink(w, r, record, status)
+}
+
+// handleUnlock handles POST /{shortened} - redirects to a password-protected URL
+func (a *App) handleUnlock(w http.ResponseWriter, r *http.Request) {
+	logger := loggerFromContext(r.Context())
+
+	shortCode := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), "/")
+
+	record, err := a.lookupURL(r.Context(), shortCode)
+	if err != nil || record.PasswordHash == "" {
+		logger.Warn("Short code not found for unlock", "short_code", shortCode, "error", err)
 		http.NotFound(w, r)
 		return
 	}
 
-	// Track the click asynchronously
-	go func() {
-		userAgent := r.Header.Get("User-Agent")
-		referer := r.Header.Get("Referer")
+	if !a.linkAvailable(w, r, record) {
+		return
+	}
+
+	if !record.checkPassword(r.PostFormValue("password")) {
+		logger.Warn("Incorrect password", "short_code", shortCode)
+		a.metrics.redirect(outcomeWrongPassword)
+		renderUnlockForm(w, http.StatusUnauthorized, shortCode, "Incorrect password")
+		return
+	}
+
+	a.followLink(w, r, record, http.StatusSeeOther)
+}
+
+// linkAvailable writes an error and returns false for disabled, expired, used up
+// or blocked links. The policy is re-checked so that newly blocked destinations
+// stop redirecting.
+func (a *App) linkAvailable(w http.ResponseWriter, r *http.Request, record *URLRecord) bool {
+	logger := loggerFromContext(r.Context())
+
+	if record.Disabled {
+		logger.Info("Short code disabled", "short_code", record.ShortCode)
+		a.metrics.redirect(outcomeDisabled)
+		http.Error(w, "This link has been disabled", http.StatusGone)
+		return false
+	}
+
+	if record.IsExhausted() {
+		logger.Info("Short code click limit reached", "short_code", record.ShortCode, "max_clicks", *record.MaxClicks)
+		a.metrics.redirect(outcomeClickLimit)
+		http.Error(w, "This link has reached its click limit", http.StatusGone)
+		return false
+	}
+
+	if record.IsExpired(time.Now()) {
+		logger.Info("Short code expired", "short_code", record.ShortCode, "expires_at", record.ExpiresAt)
+		a.metrics.redirect(outcomeExpired)
+		http.Error(w, "This link has expired", http.StatusGone)
+		return false
+	}
+
+	if err := a.checkPolicy(record.OriginalURL); err != nil {
+		logger.Warn("Short code blocked by policy", "short_code", record.ShortCode, "error", err)
+		a.metrics.redirect(outcomeBlocked)
+		http.Error(w, "This link has been blocked", http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
+// renderUnlockForm writes the embedded password form for a short code
+func renderUnlockForm(w http.ResponseWriter, status int, shortCode, message string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	data := struct{ ShortCode, Error string }{shortCode, message}
+	if err := unlockTemplate.Execute(w, data); err != nil {
+		log.Error("Failed to render unlock form", "error", err)
+	}
+}
+
+// followLink tracks a click on record and redirects to its destination. Bots
+// following click-limited links get a preview without the destination instead.
+func (a *App) followLink(w http.ResponseWriter, r *http.Request, record *URLRecord, status int) {
+	logger := loggerFromContext(r.Context())
+
+	shortCode := record.ShortCode
+	click := &Click{
+		URLID:     record.ID,
+		UserAgent: r.Header.Get("User-Agent"),
+		Referer:   r.Header.Get("Referer"),
+		IsBot:     isBotRequest(r),
+		Time:      time.Now(),
+	}
 
-		if err := a.trackClick(record.ID, userAgent, referer); err != nil {
-			log.Error("Failed to track click", "error", err, "url_id", record.ID)
+	// The salt of the day is only kept until the next one, so hash the visitor now
+	visitor, err := a.visitorHash(r.Context(), clientIP(r, a.trustedProxies), click.UserAgent, click.Time)
+	if err != nil {
+		logger.Error("Failed to hash visitor, recording click without it", "error", err, "url_id", record.ID)
+	}
+	click.VisitorHash = visitor
+
+	if record.MaxClicks != nil {
+		// Click-limited links must claim a click before redirecting
+		err := a.trackClick(r.Context(), click)
+		if errors.Is(err, ErrClickLimitReached) {
+			logger.Info("Short code click limit reached", "short_code", shortCode, "max_clicks", *record.MaxClicks)
+			a.metrics.redirect(outcomeClickLimit)
+			http.Error(w, "This link has reached its click limit", http.StatusGone)
+			return
+		}
+		if err != nil {
+			logger.Error("Failed to track click", "error", err, "url_id", record.ID)
+			writeError(w, http.StatusInternalServerError, "Failed to track click")
+			return
 		}
-	}()
 
-	log.Info("Redirecting", "short_code", shortCode, "original_url", record.OriginalURL)
-	http.Redirect(w, r, record.OriginalURL, http.StatusMovedPermanently)
+		if click.IsBot {
+			// Bots don't use up the limit, so they don't get the destination either;
+			// otherwise a HEAD request or link preview would reveal it for free
+			logger.Info("Previewing click-limited short code for bot", "short_code", shortCode, "user_agent", click.UserAgent)
+			a.metrics.redirect(outcomePreviewed)
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Header().Set("Cache-Control", "no-store")
+			w.Header().Set("X-Robots-Tag", "noindex")
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprintln(w, "This link can only be followed a limited number of times. Open it in a browser to continue.")
+			return
+		}
+	} else if !a.clicks.Enqueue(click) {
+		// Other clicks are written in batches by the click queue
+		logger.Warn("Click queue full, dropping click", "url_id", record.ID)
+	}
+
+	logger.Info("Redirecting", "short_code", shortCode, "original_url", record.OriginalURL, "bot", click.IsBot)
+	a.metrics.redirect(outcomeRedirected)
+	http.Redirect(w, r, record.OriginalURL, status)
+}
+
+// handleUpdate handles PATCH /{shortened} - retargets a shortened URL
+func (a *App) handleUpdate(w http.ResponseWriter, r *http.Request) {
+	logger := loggerFromContext(r.Context())
+	shortCode := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if !a.authorizeLink(w, r, shortCode) {
+		return
+	}
+
+	var req UpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("Invalid request body", "error", err, "method", r.Method)
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	// Changes are attributed to the API key, which authorizeLink has checked, or
+	// to the operator when made with the admin token
+	req.Actor = "admin"
+	if key := apiKeyFromContext(r.Context()); key != nil {
+		req.Actor = key.Name
+	}
+
+	record, err := a.updateURL(r.Context(), shortCode, &req)
+	if errors.Is(err, ErrNotFound) {
+		logger.Warn("Short code not found for update", "short_code", shortCode)
+		writeError(w, http.StatusNotFound, "Short code not found")
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to update URL", "error", err, "short_code", shortCode)
+		writeShortenError(w, err)
+		return
+	}
+
+	logger.Info("URL updated", "short_code", shortCode, "original_url", record.OriginalURL, "actor", req.Actor)
+	writeJSON(w, http.StatusOK, a.shortenResponse(record))
+}
+
+// handleDelete handles DELETE /{shortened} - permanently removes a shortened URL
+func (a *App) handleDelete(w http.ResponseWriter, r *http.Request) {
+	logger := loggerFromContext(r.Context())
+	shortCode := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if !a.authorizeLink(w, r, shortCode) {
+		return
+	}
+
+	err := a.deleteURL(r.Context(), shortCode)
+	if errors.Is(err, ErrNotFound) {
+		logger.Warn("Short code not found for delete", "short_code", shortCode)
+		writeError(w, http.StatusNotFound, "Short code not found")
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to delete URL", "error", err, "short_code", shortCode)
+		writeError(w, http.StatusInternalServerError, "Failed to delete URL")
+		return
+	}
+
+	logger.Info("URL deleted", "short_code", shortCode)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleDisable handles POST /{shortened}/disable - stops a shortened URL from redirecting
+func (a *App) handleDisable(w http.ResponseWriter, r *http.Request) {
+	a.setDisabledFromRequest(w, r, "/disable", true)
+}
+
+// handleEnable handles POST /{shortened}/enable - re-enables a disabled shortened URL
+func (a *App) handleEnable(w http.ResponseWriter, r *http.Request) {
+	a.setDisabledFromRequest(w, r, "/enable", false)
+}
+
+// setDisabledFromRequest updates the disabled state of the short code in the
+// request path and responds with its stats
+func (a *App) setDisabledFromRequest(w http.ResponseWriter, r *http.Request, suffix string, disabled bool) {
+	logger := loggerFromContext(r.Context())
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	shortCode := strings.TrimSuffix(path, suffix)
+	if !a.authorizeLink(w, r, shortCode) {
+		return
+	}
+
+	err := a.setDisabled(r.Context(), shortCode, disabled)
+	if errors.Is(err, ErrNotFound) {
+		logger.Warn("Short code not found for disable state change", "short_code", shortCode)
+		writeError(w, http.StatusNotFound, "Short code not found")
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to change disable state", "error", err, "short_code", shortCode)
+		writeError(w, http.StatusInternalServerError, "Failed to update URL")
+		return
+	}
+
+	stats, err := a.getStats(r.Context(), shortCode)
+	if err != nil {
+		logger.Error("Failed to get stats", "error", err, "short_code", shortCode)
+		writeError(w, http.StatusInternalServerError, "Failed to get stats")
+		return
+	}
+
+	logger.Info("Disable state changed", "short_code", shortCode, "disabled", disabled)
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// handleHistory handles GET /{shortened}/history - returns previous destinations
+func (a *App) handleHistory(w http.ResponseWriter, r *http.Request) {
+	logger := loggerFromContext(r.Context())
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	shortCode := strings.TrimSuffix(path, "/history")
+
+	if shortCode == "" {
+		logger.Error("Empty short code in history request", "path", r.URL.Path)
+		writeError(w, http.StatusBadRequest, "Short code is required")
+		return
+	}
+
+	// The history names the keys that changed the link, so only its owner sees it
+	if !a.authorizeLink(w, r, shortCode) {
+		return
+	}
+
+	history, err := a.getHistory(r.Context(), shortCode)
+	if err != nil {
+		logger.Warn("Failed to get history", "short_code", shortCode, "error", err)
+		writeError(w, http.StatusNotFound, "Short code not found")
+		return
+	}
+
+	logger.Info("History retrieved", "short_code", shortCode, "revisions", len(history.Revisions))
+	writeJSON(w, http.StatusOK, history)
+}
+
+// includeBots reports whether the include_bots query parameter asks for bot
+// clicks to be counted in statistics
+func includeBots(r *http.Request) bool {
+	include, _ := strconv.ParseBool(r.URL.Query().Get("include_bots"))
+	return include
 }
 
 // handleStats handles GET /{shortened}/stats - returns URL statistics
 func (a *App) handleStats(w http.ResponseWriter, r *http.Request) {
-	log.Info("Stats requested", "method", r.Method, "path", r.URL.Path)
+	logger := loggerFromContext(r.Context())
+
 	path := strings.TrimPrefix(r.URL.Path, "/")
 	shortCode := strings.TrimSuffix(path, "/stats")
 
 	if shortCode == "" {
-		log.Error("Empty short code in stats request", "path", r.URL.Path)
+		logger.Error("Empty short code in stats request", "path", r.URL.Path)
 		writeError(w, http.StatusBadRequest, "Short code is required")
 		return
 	}
 
-	stats, err := a.getStats(shortCode)
+	stats, err := a.getStats(r.Context(), shortCode)
 	if err != nil {
-		log.Warn("Failed to get stats", "short_code", shortCode, "error", err)
+		logger.Warn("Failed to get stats", "short_code", shortCode, "error", err)
 		writeError(w, http.StatusNotFound, "Short code not found")
 		return
 	}
 
-	log.Info("Stats retrieved", "short_code", shortCode, "clicks", stats.TotalClicks)
+	if includeBots(r) {
+		stats.TotalClicks += stats.BotClicks
+	}
+
+	logger.Info("Stats retrieved", "short_code", shortCode, "clicks", stats.TotalClicks)
 	writeJSON(w, http.StatusOK, stats)
 }
 
 // handleQR handles GET /{shortened}/qr - generates QR code
 func (a *App) handleQR(w http.ResponseWriter, r *http.Request) {
-	log.Info("QR code requested", "method", r.Method, "path", r.URL.Path)
+	logger := loggerFromContext(r.Context())
+
 	path := strings.TrimPrefix(r.URL.Path, "/")
 	shortCode := strings.TrimSuffix(path, "/qr")
 
 	if shortCode == "" {
-		log.Error("Empty short code in QR request", "path", r.URL.Path)
+		logger.Error("Empty short code in QR request", "path", r.URL.Path)
 		writeError(w, http.StatusBadRequest, "Short code is required")
 		return
 	}
 
 	// Verify short code exists
-	record, err := a.getURL(shortCode)
+	record, err := a.lookupURL(r.Context(), shortCode)
 	if err != nil {
-		log.Warn("Short code not found for QR", "short_code", shortCode, "error", err)
+		logger.Warn("Short code not found for QR", "short_code", shortCode, "error", err)
 		writeError(w, http.StatusNotFound, "Short code not found")
 		return
 	}
@@ -155,9 +480,12 @@ func (a *App) handleQR(w http.ResponseWriter, r *http.Request) {
 	shortURL := fmt.Sprintf("%s/%s", a.config.BaseURL, shortCode)
 
 	// Generate QR code
+	_, span := a.tracer.Start(r.Context(), "renderQR")
+	start := time.Now()
 	qr, err := qrcode.New(shortURL, qrcode.Medium)
 	if err != nil {
-		log.Error("Failed to generate QR code", "error", err, "url", shortURL)
+		endSpan(span, err)
+		logger.Error("Failed to generate QR code", "error", err, "url", shortURL)
 		writeError(w, http.StatusInternalServerError, "Failed to generate QR code")
 		return
 	}
@@ -168,14 +496,16 @@ func (a *App) handleQR(w http.ResponseWriter, r *http.Request) {
 
 	// Write QR code as PNG
 	png, err := qr.PNG(256)
+	endSpan(span, err)
 	if err != nil {
-		log.Error("Failed to encode QR code as PNG", "error", err)
+		logger.Error("Failed to encode QR code as PNG", "error", err)
 		writeError(w, http.StatusInternalServerError, "Failed to encode QR code")
 		return
 	}
+	a.metrics.qrDuration.Observe(time.Since(start).Seconds())
 
 	w.WriteHeader(http.StatusOK)
 	w.Write(png)
 
-	log.Info("QR code generated", "short_code", shortCode, "original_url", record.OriginalURL)
+	logger.Info("QR code generated", "short_code", shortCode, "original_url", record.OriginalURL)
 }
@@ -2,11 +2,13 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 func setupTestApp(t *testing.T) *App {
@@ -16,9 +18,10 @@ func setupTestApp(t *testing.T) *App {
 		DatabaseURL: "file::memory:?cache=shared",
 		Port:        "7000",
 		BaseURL:     "http://localhost:7000",
+		AdminToken:  testAdminToken,
 	}
 
-	app, err := NewApp(context.Background(), cfg)
+	app, err := NewApp(context.Background(), cfg, WithResolver(publicResolver{}))
 	if err != nil {
 		t.Fatalf("Failed to create test app: %v", err)
 	}
@@ -26,9 +29,45 @@ func setupTestApp(t *testing.T) *App {
 	return app
 }
 
+// testAdminToken is the admin token of apps created by setupTestApp
+const testAdminToken = "test-admin-token"
+
+// withAdminToken authenticates a request with testAdminToken
+func withAdminToken(r *http.Request) *http.Request {
+	r.Header.Set("Authorization", "Bearer "+testAdminToken)
+	return r
+}
+
+// testDB returns the database of an app created by setupTestApp
+func testDB(app *App) *sql.DB {
+	return app.store.(*sqlStore).db
+}
+
+// testAPIKey creates an API key and returns it as authMiddleware resolves it
+func testAPIKey(t *testing.T, app *App, name string) *APIKey {
+	t.Helper()
+
+	key, err := app.createAPIKey(context.Background(), name)
+	if err != nil {
+		t.Fatalf("Failed to create API key: %v", err)
+	}
+
+	apiKey, err := app.lookupAPIKey(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Failed to look up API key: %v", err)
+	}
+
+	return apiKey
+}
+
+// withAPIKey authenticates a request with key, as authMiddleware does
+func withAPIKey(r *http.Request, key *APIKey) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), apiKeyContextKey, key))
+}
+
 func TestHandleShortenPOST(t *testing.T) {
 	app := setupTestApp(t)
-	defer app.db.Close()
+	defer app.store.Close()
 
 	reqBody := `{"url":"https://www.example.com"}`
 	req := httptest.NewRequest("POST", "/s", strings.NewReader(reqBody))
@@ -57,7 +96,7 @@ func TestHandleShortenPOST(t *testing.T) {
 
 func TestHandleShortenPOST_InvalidJSON(t *testing.T) {
 	app := setupTestApp(t)
-	defer app.db.Close()
+	defer app.store.Close()
 
 	reqBody := `{invalid json`
 	req := httptest.NewRequest("POST", "/s", strings.NewReader(reqBody))
@@ -73,7 +112,7 @@ func TestHandleShortenPOST_InvalidJSON(t *testing.T) {
 
 func TestHandleShortenPOST_InvalidURL(t *testing.T) {
 	app := setupTestApp(t)
-	defer app.db.Close()
+	defer app.store.Close()
 
 	reqBody := `{"url":"not-a-valid-url"}`
 	req := httptest.NewRequest("POST", "/s", strings.NewReader(reqBody))
@@ -89,7 +128,7 @@ func TestHandleShortenPOST_InvalidURL(t *testing.T) {
 
 func TestHandleShortenGET(t *testing.T) {
 	app := setupTestApp(t)
-	defer app.db.Close()
+	defer app.store.Close()
 
 	req := httptest.NewRequest("GET", "/s?u=https://www.example.com", nil)
 	rec := httptest.NewRecorder()
@@ -116,7 +155,7 @@ func TestHandleShortenGET(t *testing.T) {
 
 func TestHandleShortenGET_MissingParam(t *testing.T) {
 	app := setupTestApp(t)
-	defer app.db.Close()
+	defer app.store.Close()
 
 	req := httptest.NewRequest("GET", "/s", nil)
 	rec := httptest.NewRecorder()
@@ -139,7 +178,7 @@ func TestHandleShortenGET_MissingParam(t *testing.T) {
 
 func TestHandleShortenGET_InvalidURL(t *testing.T) {
 	app := setupTestApp(t)
-	defer app.db.Close()
+	defer app.store.Close()
 
 	req := httptest.NewRequest("GET", "/s?u=not-a-valid-url", nil)
 	rec := httptest.NewRecorder()
@@ -153,7 +192,7 @@ func TestHandleShortenGET_InvalidURL(t *testing.T) {
 
 func TestHandleShortenGET_SameURLReturnsSameCode(t *testing.T) {
 	app := setupTestApp(t)
-	defer app.db.Close()
+	defer app.store.Close()
 
 	testURL := "https://www.example.com/test"
 
@@ -185,7 +224,7 @@ func TestHandleShortenGET_SameURLReturnsSameCode(t *testing.T) {
 
 func TestHandleRedirect(t *testing.T) {
 	app := setupTestApp(t)
-	defer app.db.Close()
+	defer app.store.Close()
 
 	// Create a shortened URL first
 	reqBody := `{"url":"https://www.example.com/redirect-test"}`
@@ -219,7 +258,7 @@ func TestHandleRedirect(t *testing.T) {
 
 func TestHandleRedirect_WithTrailingSlash(t *testing.T) {
 	app := setupTestApp(t)
-	defer app.db.Close()
+	defer app.store.Close()
 
 	// Create a shortened URL
 	reqBody := `{"url":"https://www.example.com/trailing-slash-test"}`
@@ -251,7 +290,7 @@ func TestHandleRedirect_WithTrailingSlash(t *testing.T) {
 
 func TestHandleRedirect_NotFound(t *testing.T) {
 	app := setupTestApp(t)
-	defer app.db.Close()
+	defer app.store.Close()
 
 	req := httptest.NewRequest("GET", "/nonexistent", nil)
 	rec := httptest.NewRecorder()
@@ -265,7 +304,7 @@ func TestHandleRedirect_NotFound(t *testing.T) {
 
 func TestHandleRedirect_SpecialEndpoints(t *testing.T) {
 	app := setupTestApp(t)
-	defer app.db.Close()
+	defer app.store.Close()
 
 	testCases := []struct {
 		path string
@@ -293,7 +332,7 @@ func TestHandleRedirect_SpecialEndpoints(t *testing.T) {
 
 func TestHandleStats(t *testing.T) {
 	app := setupTestApp(t)
-	defer app.db.Close()
+	defer app.store.Close()
 
 	// Create a shortened URL
 	reqBody := `{"url":"https://www.example.com/stats-test"}`
@@ -340,7 +379,7 @@ func TestHandleStats(t *testing.T) {
 
 func TestHandleStats_NotFound(t *testing.T) {
 	app := setupTestApp(t)
-	defer app.db.Close()
+	defer app.store.Close()
 
 	req := httptest.NewRequest("GET", "/nonexistent/stats", nil)
 	rec := httptest.NewRecorder()
@@ -354,7 +393,7 @@ func TestHandleStats_NotFound(t *testing.T) {
 
 func TestHandleStats_EmptyShortCode(t *testing.T) {
 	app := setupTestApp(t)
-	defer app.db.Close()
+	defer app.store.Close()
 
 	req := httptest.NewRequest("GET", "//stats", nil)
 	rec := httptest.NewRecorder()
@@ -368,7 +407,7 @@ func TestHandleStats_EmptyShortCode(t *testing.T) {
 
 func TestHandleQR(t *testing.T) {
 	app := setupTestApp(t)
-	defer app.db.Close()
+	defer app.store.Close()
 
 	// Create a shortened URL
 	reqBody := `{"url":"https://www.example.com/qr-test"}`
@@ -414,7 +453,7 @@ func TestHandleQR(t *testing.T) {
 
 func TestHandleQR_NotFound(t *testing.T) {
 	app := setupTestApp(t)
-	defer app.db.Close()
+	defer app.store.Close()
 
 	req := httptest.NewRequest("GET", "/nonexistent/qr", nil)
 	rec := httptest.NewRecorder()
@@ -428,7 +467,7 @@ func TestHandleQR_NotFound(t *testing.T) {
 
 func TestHandleQR_EmptyShortCode(t *testing.T) {
 	app := setupTestApp(t)
-	defer app.db.Close()
+	defer app.store.Close()
 
 	req := httptest.NewRequest("GET", "//qr", nil)
 	rec := httptest.NewRecorder()
@@ -439,3 +478,525 @@ func TestHandleQR_EmptyShortCode(t *testing.T) {
 		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
 	}
 }
+
+func TestHandleShortenPOST_Alias(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	reqBody := `{"url":"https://www.example.com/alias-handler","alias":"team-docs"}`
+	req := httptest.NewRequest("POST", "/s", strings.NewReader(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	app.handleShorten(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, rec.Code)
+	}
+
+	redirectReq := httptest.NewRequest("GET", "/team-docs", nil)
+	redirectRec := httptest.NewRecorder()
+	app.handleRedirect(redirectRec, redirectReq)
+
+	if redirectRec.Code != http.StatusMovedPermanently {
+		t.Errorf("Expected status %d, got %d", http.StatusMovedPermanently, redirectRec.Code)
+	}
+
+	location := redirectRec.Header().Get("Location")
+	if location != "https://www.example.com/alias-handler" {
+		t.Errorf("Expected redirect to 'https://www.example.com/alias-handler', got '%s'", location)
+	}
+}
+
+func TestHandleShortenPOST_AliasConflict(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	reqBody := `{"url":"https://www.example.com/alias-conflict","alias":"team-docs"}`
+	for i, expected := range []int{http.StatusCreated, http.StatusConflict} {
+		req := httptest.NewRequest("POST", "/s", strings.NewReader(reqBody))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+
+		app.handleShorten(rec, req)
+
+		if rec.Code != expected {
+			t.Errorf("Request %d: expected status %d, got %d", i+1, expected, rec.Code)
+		}
+	}
+}
+
+func TestHandleShortenPOST_InvalidAlias(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	reqBody := `{"url":"https://www.example.com/alias-invalid","alias":"health"}`
+	req := httptest.NewRequest("POST", "/s", strings.NewReader(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	app.handleShorten(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestHandleRedirect_Expired(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	reqBody := `{"url":"https://www.example.com/expired","ttl_seconds":60}`
+	req := httptest.NewRequest("POST", "/s", strings.NewReader(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	app.handleShorten(rec, req)
+
+	var resp ShortenResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	// Move the expiry into the past
+	_, err := testDB(app).Exec("UPDATE urls SET expires_at = ? WHERE short_code = ?",
+		time.Now().Add(-time.Minute).UTC().Format(dbTimeFormat), resp.ShortCode)
+	if err != nil {
+		t.Fatalf("Failed to update expiry: %v", err)
+	}
+
+	redirectReq := httptest.NewRequest("GET", "/"+resp.ShortCode, nil)
+	redirectRec := httptest.NewRecorder()
+	app.handleRedirect(redirectRec, redirectReq)
+
+	if redirectRec.Code != http.StatusGone {
+		t.Errorf("Expected status %d, got %d", http.StatusGone, redirectRec.Code)
+	}
+}
+
+func TestHandleRedirect_ClickLimit(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	reqBody := `{"url":"https://www.example.com/one-time","max_clicks":1}`
+	req := httptest.NewRequest("POST", "/s", strings.NewReader(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	app.handleShorten(rec, req)
+
+	var resp ShortenResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	for i, expected := range []int{http.StatusFound, http.StatusGone} {
+		redirectReq := httptest.NewRequest("GET", "/"+resp.ShortCode, nil)
+		redirectRec := httptest.NewRecorder()
+		app.handleRedirect(redirectRec, redirectReq)
+
+		if redirectRec.Code != expected {
+			t.Errorf("Request %d: expected status %d, got %d", i+1, expected, redirectRec.Code)
+		}
+	}
+}
+
+func TestHandleRedirect_PasswordProtected(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	reqBody := `{"url":"https://www.example.com/internal-doc","password":"hunter2"}`
+	req := httptest.NewRequest("POST", "/s", strings.NewReader(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	app.handleShorten(rec, req)
+
+	var resp ShortenResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	// GET serves the unlock form instead of redirecting
+	redirectReq := httptest.NewRequest("GET", "/"+resp.ShortCode, nil)
+	redirectRec := httptest.NewRecorder()
+	app.handleRedirect(redirectRec, redirectReq)
+
+	if redirectRec.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, redirectRec.Code)
+	}
+
+	if redirectRec.Header().Get("Location") != "" || !strings.Contains(redirectRec.Body.String(), `name="password"`) {
+		t.Error("Expected unlock form without redirect")
+	}
+
+	testCases := []struct {
+		password string
+		expected int
+		name     string
+	}{
+		{"wrong", http.StatusUnauthorized, "wrong password"},
+		{"hunter2", http.StatusSeeOther, "correct password"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			form := "password=" + tc.password
+			unlockReq := httptest.NewRequest("POST", "/"+resp.ShortCode, strings.NewReader(form))
+			unlockReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			unlockRec := httptest.NewRecorder()
+			app.handleUnlock(unlockRec, unlockReq)
+
+			if unlockRec.Code != tc.expected {
+				t.Errorf("Expected status %d, got %d", tc.expected, unlockRec.Code)
+			}
+
+			location := unlockRec.Header().Get("Location")
+			if tc.expected == http.StatusSeeOther && location != "https://www.example.com/internal-doc" {
+				t.Errorf("Expected redirect to 'https://www.example.com/internal-doc', got '%s'", location)
+			}
+		})
+	}
+}
+
+func TestHandleUpdateAndHistory(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	key := testAPIKey(t, app, "docs-team")
+
+	resp, err := app.createShortURL(context.Background(), &ShortenRequest{URL: "https://www.example.com/moved-doc", APIKeyID: key.ID})
+	if err != nil {
+		t.Fatalf("Failed to create short URL: %v", err)
+	}
+
+	reqBody := `{"url":"https://docs.example.com/moved-doc","actor":"someone-else"}`
+	req := withAPIKey(httptest.NewRequest("PATCH", "/"+resp.ShortCode, strings.NewReader(reqBody)), key)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	app.handleUpdate(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	redirectReq := httptest.NewRequest("GET", "/"+resp.ShortCode, nil)
+	redirectRec := httptest.NewRecorder()
+	app.handleRedirect(redirectRec, redirectReq)
+
+	if location := redirectRec.Header().Get("Location"); location != "https://docs.example.com/moved-doc" {
+		t.Errorf("Expected redirect to new destination, got '%s'", location)
+	}
+
+	historyReq := withAPIKey(httptest.NewRequest("GET", "/"+resp.ShortCode+"/history", nil), key)
+	historyRec := httptest.NewRecorder()
+	app.handleHistory(historyRec, historyReq)
+
+	if historyRec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, historyRec.Code)
+	}
+
+	var history URLHistory
+	if err := json.NewDecoder(historyRec.Body).Decode(&history); err != nil {
+		t.Fatalf("Failed to decode history: %v", err)
+	}
+
+	if len(history.Revisions) != 1 || history.Revisions[0].PreviousURL != "https://www.example.com/moved-doc" {
+		t.Errorf("Unexpected history: %+v", history)
+	}
+
+	// The actor is the API key, not a name claimed in the body
+	if len(history.Revisions) == 1 && history.Revisions[0].Actor != "docs-team" {
+		t.Errorf("Expected actor 'docs-team', got '%s'", history.Revisions[0].Actor)
+	}
+}
+
+func TestHandleUpdate_NotFound(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	key := testAPIKey(t, app, "docs-team")
+
+	req := withAPIKey(httptest.NewRequest("PATCH", "/nonexistent", strings.NewReader(`{"url":"https://www.example.com"}`)), key)
+	rec := httptest.NewRecorder()
+	app.handleUpdate(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestHandleUpdate_RequiresAdminToken(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	resp, err := app.createShortURL(context.Background(), &ShortenRequest{URL: "https://www.example.com/guarded"})
+	if err != nil {
+		t.Fatalf("Failed to create short URL: %v", err)
+	}
+
+	for _, authorization := range []string{"", "Bearer wrong-token", "Basic " + testAdminToken} {
+		req := httptest.NewRequest("PATCH", "/"+resp.ShortCode, strings.NewReader(`{"url":"https://evil.example.com"}`))
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		app.handleUpdate(rec, req)
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status %d for '%s', got %d", http.StatusUnauthorized, authorization, rec.Code)
+		}
+	}
+
+	// Without a configured admin token links can't be changed at all
+	app.config.AdminToken = ""
+	rec := httptest.NewRecorder()
+	app.handleUpdate(rec, withAdminToken(httptest.NewRequest("PATCH", "/"+resp.ShortCode, strings.NewReader(`{"url":"https://evil.example.com"}`))))
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d without admin token configured, got %d", http.StatusUnauthorized, rec.Code)
+	}
+
+	record, err := app.getURL(context.Background(), resp.ShortCode)
+	if err != nil || record.OriginalURL != "https://www.example.com/guarded" {
+		t.Errorf("Expected destination to be unchanged, got %+v (%v)", record, err)
+	}
+}
+
+func TestHandleHistory_NotFound(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	req := withAdminToken(httptest.NewRequest("GET", "/nonexistent/history", nil))
+	rec := httptest.NewRecorder()
+	app.handleHistory(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestHandleHistory_RequiresOwner(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	owner := testAPIKey(t, app, "docs-team")
+	other := testAPIKey(t, app, "someone-else")
+	resp, err := app.createShortURL(context.Background(), &ShortenRequest{URL: "https://www.example.com/private-history", APIKeyID: owner.ID})
+	if err != nil {
+		t.Fatalf("Failed to create short URL: %v", err)
+	}
+
+	testCases := []struct {
+		key      *APIKey
+		expected int
+		name     string
+	}{
+		{nil, http.StatusUnauthorized, "no key"},
+		{other, http.StatusNotFound, "other key"},
+		{owner, http.StatusOK, "owner"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/"+resp.ShortCode+"/history", nil)
+			if tc.key != nil {
+				req = withAPIKey(req, tc.key)
+			}
+			rec := httptest.NewRecorder()
+			app.handleHistory(rec, req)
+
+			if rec.Code != tc.expected {
+				t.Errorf("Expected status %d, got %d", tc.expected, rec.Code)
+			}
+		})
+	}
+}
+
+func TestHandleDisable(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	key := testAPIKey(t, app, "docs-team")
+
+	resp, err := app.createShortURL(context.Background(), &ShortenRequest{URL: "https://www.example.com/disable-handler", APIKeyID: key.ID})
+	if err != nil {
+		t.Fatalf("Failed to create short URL: %v", err)
+	}
+
+	disableReq := withAPIKey(httptest.NewRequest("POST", "/"+resp.ShortCode+"/disable", nil), key)
+	disableRec := httptest.NewRecorder()
+	app.handleDisable(disableRec, disableReq)
+
+	if disableRec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, disableRec.Code)
+	}
+
+	redirectReq := httptest.NewRequest("GET", "/"+resp.ShortCode, nil)
+	redirectRec := httptest.NewRecorder()
+	app.handleRedirect(redirectRec, redirectReq)
+
+	if redirectRec.Code != http.StatusGone {
+		t.Errorf("Expected status %d, got %d", http.StatusGone, redirectRec.Code)
+	}
+
+	// Disabled links stay visible in stats
+	statsReq := httptest.NewRequest("GET", "/"+resp.ShortCode+"/stats", nil)
+	statsRec := httptest.NewRecorder()
+	app.handleStats(statsRec, statsReq)
+
+	var stats URLStats
+	if err := json.NewDecoder(statsRec.Body).Decode(&stats); err != nil {
+		t.Fatalf("Failed to decode stats: %v", err)
+	}
+
+	if statsRec.Code != http.StatusOK || !stats.Disabled {
+		t.Errorf("Expected disabled stats, got status %d and %+v", statsRec.Code, stats)
+	}
+
+	enableReq := withAPIKey(httptest.NewRequest("POST", "/"+resp.ShortCode+"/enable", nil), key)
+	enableRec := httptest.NewRecorder()
+	app.handleEnable(enableRec, enableReq)
+
+	redirectRec = httptest.NewRecorder()
+	app.handleRedirect(redirectRec, httptest.NewRequest("GET", "/"+resp.ShortCode, nil))
+
+	if redirectRec.Code != http.StatusMovedPermanently {
+		t.Errorf("Expected status %d after enable, got %d", http.StatusMovedPermanently, redirectRec.Code)
+	}
+}
+
+func TestHandleDelete(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	key := testAPIKey(t, app, "docs-team")
+
+	resp, err := app.createShortURL(context.Background(), &ShortenRequest{URL: "https://www.example.com/delete-handler", APIKeyID: key.ID})
+	if err != nil {
+		t.Fatalf("Failed to create short URL: %v", err)
+	}
+
+	for i, expected := range []int{http.StatusNoContent, http.StatusNotFound} {
+		req := withAPIKey(httptest.NewRequest("DELETE", "/"+resp.ShortCode, nil), key)
+		rec := httptest.NewRecorder()
+		app.handleDelete(rec, req)
+
+		if rec.Code != expected {
+			t.Errorf("Request %d: expected status %d, got %d", i+1, expected, rec.Code)
+		}
+	}
+}
+
+func TestHandleManage_Ownership(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	owner := testAPIKey(t, app, "owner")
+	other := testAPIKey(t, app, "other")
+
+	owned, err := app.createShortURL(context.Background(), &ShortenRequest{URL: "https://www.example.com/owned", APIKeyID: owner.ID})
+	if err != nil {
+		t.Fatalf("Failed to create short URL: %v", err)
+	}
+
+	anonymous, err := app.createShortURL(context.Background(), &ShortenRequest{URL: "https://www.example.com/anonymous"})
+	if err != nil {
+		t.Fatalf("Failed to create short URL: %v", err)
+	}
+
+	testCases := []struct {
+		name      string
+		shortCode string
+		key       *APIKey
+		expected  int
+	}{
+		{"missing key", owned.ShortCode, nil, http.StatusUnauthorized},
+		{"other key", owned.ShortCode, other, http.StatusNotFound},
+		{"unowned link", anonymous.ShortCode, owner, http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			requests := map[string]*http.Request{
+				"update":  httptest.NewRequest("PATCH", "/"+tc.shortCode, strings.NewReader(`{"url":"https://evil.example.com"}`)),
+				"disable": httptest.NewRequest("POST", "/"+tc.shortCode+"/disable", nil),
+				"delete":  httptest.NewRequest("DELETE", "/"+tc.shortCode, nil),
+			}
+			handlers := map[string]http.HandlerFunc{
+				"update":  app.handleUpdate,
+				"disable": app.handleDisable,
+				"delete":  app.handleDelete,
+			}
+
+			for action, req := range requests {
+				if tc.key != nil {
+					req = withAPIKey(req, tc.key)
+				}
+				rec := httptest.NewRecorder()
+				handlers[action](rec, req)
+
+				if rec.Code != tc.expected {
+					t.Errorf("%s: expected status %d, got %d", action, tc.expected, rec.Code)
+				}
+			}
+
+			// The link still redirects to its original destination
+			redirectRec := httptest.NewRecorder()
+			app.handleRedirect(redirectRec, httptest.NewRequest("GET", "/"+tc.shortCode, nil))
+
+			if redirectRec.Code != http.StatusMovedPermanently {
+				t.Errorf("Expected status %d, got %d", http.StatusMovedPermanently, redirectRec.Code)
+			}
+		})
+	}
+}
+
+func TestHandleDisableAndDelete_RequireAdminToken(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	resp, err := app.createShortURL(context.Background(), &ShortenRequest{URL: "https://www.example.com/guarded-delete"})
+	if err != nil {
+		t.Fatalf("Failed to create short URL: %v", err)
+	}
+
+	disableRec := httptest.NewRecorder()
+	app.handleDisable(disableRec, httptest.NewRequest("POST", "/"+resp.ShortCode+"/disable", nil))
+
+	deleteRec := httptest.NewRecorder()
+	app.handleDelete(deleteRec, httptest.NewRequest("DELETE", "/"+resp.ShortCode, nil))
+
+	if disableRec.Code != http.StatusUnauthorized || deleteRec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d for disable and %d for delete", http.StatusUnauthorized, disableRec.Code, deleteRec.Code)
+	}
+
+	redirectRec := httptest.NewRecorder()
+	app.handleRedirect(redirectRec, httptest.NewRequest("GET", "/"+resp.ShortCode, nil))
+
+	if redirectRec.Code != http.StatusMovedPermanently {
+		t.Errorf("Expected link to keep redirecting, got status %d", redirectRec.Code)
+	}
+}
+
+func TestHandleManage_AdminToken(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	// Links created without a key can only be managed by the operator
+	resp, err := app.createShortURL(context.Background(), &ShortenRequest{URL: "https://www.example.com/abusive"})
+	if err != nil {
+		t.Fatalf("Failed to create short URL: %v", err)
+	}
+
+	disableRec := httptest.NewRecorder()
+	app.handleDisable(disableRec, withAdminToken(httptest.NewRequest("POST", "/"+resp.ShortCode+"/disable", nil)))
+
+	if disableRec.Code != http.StatusOK {
+		t.Errorf("Expected status %d for disable, got %d", http.StatusOK, disableRec.Code)
+	}
+
+	deleteRec := httptest.NewRecorder()
+	app.handleDelete(deleteRec, withAdminToken(httptest.NewRequest("DELETE", "/"+resp.ShortCode, nil)))
+
+	if deleteRec.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d for delete, got %d", http.StatusNoContent, deleteRec.Code)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// readinessTimeout bounds the database checks made by /readyz
+const readinessTimeout = 2 * time.Second
+
+// ReadinessResponse represents the response of the readiness endpoint
+type ReadinessResponse struct {
+	Status                string          `json:"status"`
+	Database              string          `json:"database"`
+	SchemaVersion         int             `json:"schema_version"`
+	ExpectedSchemaVersion int             `json:"expected_schema_version"`
+	ShuttingDown          bool            `json:"shutting_down"`
+	ClickQueue            ClickQueueStats `json:"click_queue"`
+}
+
+// beginShutdown makes /readyz fail so load balancers stop sending traffic
+// while the server is still able to serve it
+func (a *App) beginShutdown() {
+	a.shuttingDown.Store(true)
+}
+
+// handleLivez handles GET /livez - reports that the process is running
+func (a *App) handleLivez(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReadyz handles GET /readyz - reports whether this instance should
+// receive traffic: the database is reachable with an up to date schema and
+// the server isn't shutting down
+func (a *App) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	logger := loggerFromContext(r.Context())
+
+	resp := ReadinessResponse{
+		Status:                "ok",
+		Database:              "ok",
+		ExpectedSchemaVersion: schemaVersion,
+		ShuttingDown:          a.shuttingDown.Load(),
+		ClickQueue:            a.clicks.Stats(),
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	if err := a.store.Ping(ctx); err != nil {
+		logger.Warn("Readiness check failed to reach database", "error", err)
+		resp.Database = "unreachable"
+	} else if version, err := a.store.SchemaVersion(ctx); err != nil {
+		logger.Warn("Readiness check failed to read schema version", "error", err)
+		resp.Database = "schema version unavailable"
+	} else {
+		resp.SchemaVersion = version
+	}
+
+	status := http.StatusOK
+	if resp.Database != "ok" || resp.SchemaVersion < schemaVersion || resp.ShuttingDown {
+		resp.Status = "unavailable"
+		status = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, status, resp)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLivez(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	rec := httptest.NewRecorder()
+	app.setupRoutes().ServeHTTP(rec, httptest.NewRequest("GET", "/livez", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	mux := app.setupRoutes()
+	readyz := func() (int, ReadinessResponse) {
+		t.Helper()
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+
+		var resp ReadinessResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return rec.Code, resp
+	}
+
+	status, resp := readyz()
+	if status != http.StatusOK || resp.Status != "ok" || resp.SchemaVersion != schemaVersion ||
+		resp.ClickQueue.Capacity == 0 {
+		t.Errorf("Expected a ready instance, got %d: %+v", status, resp)
+	}
+
+	// A database behind the expected schema isn't ready
+	if _, err := testDB(app).Exec("UPDATE schema_migrations SET version = -version WHERE version = ?", schemaVersion); err != nil {
+		t.Fatalf("Failed to change schema version: %v", err)
+	}
+	status, resp = readyz()
+	if _, err := testDB(app).Exec("UPDATE schema_migrations SET version = -version WHERE version = ?", -schemaVersion); err != nil {
+		t.Fatalf("Failed to restore schema version: %v", err)
+	}
+	if status != http.StatusServiceUnavailable || resp.SchemaVersion != schemaVersion-1 {
+		t.Errorf("Expected status %d for an old schema, got %d: %+v", http.StatusServiceUnavailable, status, resp)
+	}
+
+	app.beginShutdown()
+	status, resp = readyz()
+	if status != http.StatusServiceUnavailable || !resp.ShuttingDown || resp.Database != "ok" {
+		t.Errorf("Expected status %d while shutting down, got %d: %+v", http.StatusServiceUnavailable, status, resp)
+	}
+}
+
+func TestReadyz_DatabaseUnreachable(t *testing.T) {
+	app := setupTestApp(t)
+	app.store.Close()
+
+	rec := httptest.NewRecorder()
+	app.setupRoutes().ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+
+	var resp ReadinessResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if rec.Code != http.StatusServiceUnavailable || resp.Database != "unreachable" {
+		t.Errorf("Expected status %d with an unreachable database, got %d: %+v", http.StatusServiceUnavailable, rec.Code, resp)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// requestIDHeader carries the ID of a request, taken from the client or a
+// proxy when valid and generated otherwise
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds request IDs accepted from clients
+const maxRequestIDLength = 128
+
+type loggerContextKeyType struct{}
+
+var loggerContextKey = loggerContextKeyType{}
+
+// loggerFromContext returns the request-scoped logger stored in ctx by
+// requestLogMiddleware, or the global logger outside of a request
+func loggerFromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerContextKey).(*slog.Logger); ok {
+		return logger
+	}
+	return log
+}
+
+// newRequestID returns a random 128-bit request ID
+func newRequestID() string {
+	id := make([]byte, 16)
+	// crypto/rand.Read never returns an error
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// validRequestID reports whether a client supplied request ID is safe to log
+// and echo back: not too long and limited to URL-safe characters
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-' || c == '_' || c == '.' || c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// statusRecorder captures the status code and size of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// statusCode returns the status written so far, which is 200 if nothing was
+func (r *statusRecorder) statusCode() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
+// requestLogMiddleware assigns every request an ID, returned in the
+// X-Request-ID header, stores a logger tagged with it and the trace ID in the
+// request context and writes one access log line per request once served
+func (a *App) requestLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		logger := log.With("request_id", id)
+		if span := trace.SpanContextFromContext(r.Context()); span.IsValid() {
+			logger = logger.With("trace_id", span.TraceID().String())
+		}
+		r = r.WithContext(context.WithValue(r.Context(), loggerContextKey, logger))
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+
+		logger.Info("Request completed",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", recorder.statusCode(),
+			"bytes", recorder.bytes,
+			"duration_ms", float64(time.Since(start).Microseconds())/1000,
+			"remote_addr", r.RemoteAddr,
+			"client_ip", clientIP(r, a.trustedProxies),
+			"user_agent", r.UserAgent(),
+		)
+	})
+}
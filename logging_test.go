@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestLogMiddleware_RequestID(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	testCases := []struct {
+		name     string
+		header   string
+		expected string
+	}{
+		{"generated", "", ""},
+		{"propagated", "edge-1234.abcd", "edge-1234.abcd"},
+		{"invalid", "bad id\nwith newline", ""},
+		{"too long", strings.Repeat("a", maxRequestIDLength+1), ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/health", nil)
+			if tc.header != "" {
+				req.Header.Set(requestIDHeader, tc.header)
+			}
+			rec := httptest.NewRecorder()
+			app.server.Handler.ServeHTTP(rec, req)
+
+			id := rec.Header().Get(requestIDHeader)
+			if tc.expected != "" && id != tc.expected {
+				t.Errorf("Expected request ID %q, got %q", tc.expected, id)
+			}
+			if tc.expected == "" && (len(id) != 32 || id == tc.header) {
+				t.Errorf("Expected a generated request ID, got %q", id)
+			}
+		})
+	}
+}
+
+func TestRequestLogMiddleware_AccessLog(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	var buf bytes.Buffer
+	previous := log
+	log = slog.New(slog.NewJSONHandler(&buf, nil))
+	defer func() { log = previous }()
+
+	req := httptest.NewRequest("POST", "/s", strings.NewReader(`{"url":"https://www.example.com/access-log"}`))
+	req.Header.Set(requestIDHeader, "access-log-test")
+	req.RemoteAddr = "192.0.2.10:4321"
+	rec := httptest.NewRecorder()
+	app.server.Handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body.String())
+	}
+
+	var lines []map[string]any
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var line map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("Failed to decode log line %q: %v", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+
+	if len(lines) < 2 {
+		t.Fatalf("Expected handler and access log lines, got %d", len(lines))
+	}
+	for _, line := range lines {
+		if line["request_id"] != "access-log-test" {
+			t.Errorf("Expected every line to carry the request ID, got %v", line)
+		}
+	}
+
+	access := lines[len(lines)-1]
+	if access["msg"] != "Request completed" || access["method"] != "POST" || access["path"] != "/s" ||
+		access["status"] != float64(http.StatusCreated) || access["bytes"] != float64(rec.Body.Len()) ||
+		access["remote_addr"] != "192.0.2.10:4321" {
+		t.Errorf("Unexpected access log line: %v", access)
+	}
+	if _, ok := access["duration_ms"].(float64); !ok {
+		t.Errorf("Expected a duration in the access log line, got %v", access)
+	}
+}
@@ -4,20 +4,25 @@ package main
 import (
 	"bytes"
 	"context"
-	"database/sql"
 	_ "embed"
 	"errors"
 	"fmt"
+	"html/template"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/joho/godotenv"
 	"github.com/sethvargo/go-envconfig"
 	_ "github.com/tursodatabase/libsql-client-go/libsql"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
 
 	_ "modernc.org/sqlite"
 )
@@ -25,6 +30,11 @@ import (
 //go:embed static/index.html
 var indexHTML []byte
 
+//go:embed static/unlock.html
+var unlockHTML string
+
+var unlockTemplate = template.Must(template.New("unlock").Parse(unlockHTML))
+
 var (
 	Version   string = "dev"
 	BuildTime string = "unknown"
@@ -49,12 +59,30 @@ func main() {
 
 	log.Info("Configuration loaded", "config", cfg)
 
+	// `ul migrate` manages the schema itself
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		cfg.SkipMigrations = true
+	}
+
 	app, err := NewApp(ctx, &cfg)
 	if err != nil {
 		log.Error("Failed to create application", "error", err)
 		os.Exit(1)
 	}
 
+	// Run a management command instead of the server if one was given
+	if len(os.Args) > 1 {
+		cmdErr := app.runCommand(os.Args[1:])
+		if err := app.store.Close(); err != nil {
+			log.Error("Database close error", "error", err)
+		}
+		if cmdErr != nil {
+			log.Error("Command failed", "error", cmdErr)
+			os.Exit(1)
+		}
+		return
+	}
+
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
@@ -69,6 +97,17 @@ func main() {
 	select {
 	case sig := <-sigChan:
 		log.Info("Received shutdown signal", "signal", sig.String())
+		app.beginShutdown()
+
+		// Keep serving while load balancers notice /readyz failing
+		if cfg.ShutdownDrainDelay > 0 {
+			log.Info("Draining traffic before shutdown", "delay", cfg.ShutdownDrainDelay)
+			select {
+			case <-time.After(cfg.ShutdownDrainDelay):
+			case sig := <-sigChan:
+				log.Warn("Received second shutdown signal, stopping now", "signal", sig.String())
+			}
+		}
 		appCancel()
 	case err := <-appErr:
 		if err != nil {
@@ -85,7 +124,17 @@ func main() {
 		log.Info("HTTP server stopped")
 	}
 
-	if err := app.db.Close(); err != nil {
+	if err := app.clicks.Close(shutdownCtx); err != nil {
+		log.Error("Click queue drain error", "error", err)
+	} else {
+		log.Info("Click queue drained", "stats", app.clicks.Stats())
+	}
+
+	if err := app.shutdownTracing(shutdownCtx); err != nil {
+		log.Error("Tracing shutdown error", "error", err)
+	}
+
+	if err := app.store.Close(); err != nil {
 		log.Error("Database close error", "error", err)
 		os.Exit(1)
 	}
@@ -94,15 +143,83 @@ func main() {
 }
 
 type Config struct {
-	DatabaseURL string `env:"UL_DATABASE_URL, required"`
-	Port        string `env:"UL_PORT, default=7000"`
-	BaseURL     string `env:"UL_BASE_URL, default=http://localhost:7000"`
+	DatabaseURL   string `env:"UL_DATABASE_URL, required"`
+	Port          string `env:"UL_PORT, default=7000"`
+	BaseURL       string `env:"UL_BASE_URL, default=http://localhost:7000"`
+	AdminToken    string `env:"UL_ADMIN_TOKEN"`
+	RequireAPIKey bool   `env:"UL_REQUIRE_API_KEY, default=false"`
+
+	// Rate limits in requests per minute per client; 0 disables the limit
+	RateLimitShorten  int      `env:"UL_RATE_LIMIT_SHORTEN, default=30"`
+	RateLimitRedirect int      `env:"UL_RATE_LIMIT_REDIRECT, default=600"`
+	RateLimitQR       int      `env:"UL_RATE_LIMIT_QR, default=60"`
+	RateLimitUnlock   int      `env:"UL_RATE_LIMIT_UNLOCK, default=5"`
+	RateLimitAuth     int      `env:"UL_RATE_LIMIT_AUTH, default=10"`
+	TrustedProxies    []string `env:"UL_TRUSTED_PROXIES"`
+
+	// Private network destinations are rejected unless allowed here, e.g. for intranet deployments
+	AllowPrivateDestinations bool     `env:"UL_ALLOW_PRIVATE_DESTINATIONS, default=false"`
+	AllowedPrivateNetworks   []string `env:"UL_ALLOWED_PRIVATE_NETWORKS"`
+
+	// Destinations whose host doesn't resolve are rejected unless allowed here
+	AllowUnresolvableDestinations bool `env:"UL_ALLOW_UNRESOLVABLE_DESTINATIONS, default=false"`
+
+	// Clicks are queued and written in batches; clicks arriving while the queue is full are dropped
+	ClickQueueSize     int           `env:"UL_CLICK_QUEUE_SIZE, default=10000"`
+	ClickBatchSize     int           `env:"UL_CLICK_BATCH_SIZE, default=500"`
+	ClickFlushInterval time.Duration `env:"UL_CLICK_FLUSH_INTERVAL, default=1s"`
+
+	// Short code lookups on the redirect path are cached; a size of 0 disables the cache
+	URLCacheSize        int           `env:"UL_URL_CACHE_SIZE, default=10000"`
+	URLCacheTTL         time.Duration `env:"UL_URL_CACHE_TTL, default=1m"`
+	URLCacheNegativeTTL time.Duration `env:"UL_URL_CACHE_NEGATIVE_TTL, default=10s"`
+
+	// Links to known URL shorteners are followed to store their final destination
+	ResolveShorteners bool     `env:"UL_RESOLVE_SHORTENERS, default=false"`
+	ShortenerHosts    []string `env:"UL_SHORTENER_HOSTS, default=bit.ly,tinyurl.com,t.co,goo.gl,ow.ly,is.gd,buff.ly,rebrand.ly,cutt.ly,shorturl.at,tiny.cc,rb.gy"`
+	MaxRedirectHops   int      `env:"UL_MAX_REDIRECT_HOPS, default=5"`
+
+	// Spans are exported over OTLP/HTTP when an endpoint such as http://collector:4318 is set
+	OTLPEndpoint     string  `env:"UL_OTLP_ENDPOINT"`
+	TraceSampleRatio float64 `env:"UL_TRACE_SAMPLE_RATIO, default=1"`
+
+	// Destination blocklist/allowlist, reloaded when the file changes
+	PolicyFile           string        `env:"UL_POLICY_FILE"`
+	PolicyReloadInterval time.Duration `env:"UL_POLICY_RELOAD_INTERVAL, default=30s"`
+
+	// Skip applying migrations on startup, e.g. when they're run with `ul migrate up` before deploying
+	SkipMigrations bool `env:"UL_SKIP_MIGRATIONS, default=false"`
+
+	// How long /readyz fails before the server stops, so load balancers can move traffic away
+	ShutdownDrainDelay time.Duration `env:"UL_SHUTDOWN_DRAIN_DELAY, default=5s"`
 }
 
 type App struct {
-	db     *sql.DB
-	config *Config
-	server *http.Server
+	store          Store
+	config         *Config
+	server         *http.Server
+	trustedProxies []*net.IPNet
+	authFailures   *rateLimiter
+	policy         URLPolicy
+	destinations   *destinationGuard
+	chains         *chainResolver
+	salts          visitorSalts
+	clicks         *clickQueue
+	urls           *urlCache
+	metrics        *metrics
+	tracer         trace.Tracer
+	tracerProvider *sdktrace.TracerProvider
+	shuttingDown   atomic.Bool
+}
+
+// HealthResponse represents the response of the health check endpoint
+type HealthResponse struct {
+	Status     string           `json:"status"`
+	Version    string           `json:"version"`
+	BuildTime  string           `json:"buildTime"`
+	Commit     string           `json:"commit"`
+	ClickQueue *ClickQueueStats `json:"click_queue,omitempty"`
+	URLCache   *URLCacheStats   `json:"url_cache,omitempty"`
 }
 
 type AppOption func(*App) error
@@ -122,22 +239,16 @@ func NewApp(ctx context.Context, config *Config, opts ...AppOption) (*App, error
 		return nil, fmt.Errorf("configuration is nil")
 	}
 
-	db, err := sql.Open("libsql", config.DatabaseURL)
+	store, err := openStore(ctx, config.DatabaseURL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %v", err)
-	}
-
-	// Verify database connection
-	if err := db.PingContext(ctx); err != nil {
-		err = db.Close()
-		return nil, fmt.Errorf("failed to ping database: %w", err)
+		return nil, err
 	}
 
 	log.Info("Database connection established")
 
 	// Create app instance
 	app := &App{
-		db:     db,
+		store:  store,
 		config: config,
 		server: &http.Server{
 			Addr:         ":" + config.Port,
@@ -147,23 +258,73 @@ func NewApp(ctx context.Context, config *Config, opts ...AppOption) (*App, error
 		},
 	}
 
-	// Initialize database schema
-	if err := app.initDB(); err != nil {
-		dberr := db.Close()
-		return nil, fmt.Errorf("failed to initialize database: %w", errors.Join(err, dberr))
+	trustedProxies, err := parseNetworks(config.TrustedProxies)
+	if err != nil {
+		dberr := store.Close()
+		return nil, fmt.Errorf("invalid trusted proxies: %w", errors.Join(err, dberr))
+	}
+	app.trustedProxies = trustedProxies
+	app.authFailures = newRateLimiter(config.RateLimitAuth)
+
+	if !config.AllowPrivateDestinations {
+		allowed, err := parseNetworks(config.AllowedPrivateNetworks)
+		if err != nil {
+			dberr := store.Close()
+			return nil, fmt.Errorf("invalid allowed private networks: %w", errors.Join(err, dberr))
+		}
+		app.destinations = &destinationGuard{
+			resolver:          net.DefaultResolver,
+			allowed:           allowed,
+			allowUnresolvable: config.AllowUnresolvableDestinations,
+		}
+	}
+
+	if config.ResolveShorteners {
+		client := &http.Client{Timeout: redirectRequestTimeout}
+		app.chains = newChainResolver(client, config.ShortenerHosts, config.MaxRedirectHops)
+	}
+
+	if config.PolicyFile != "" {
+		policy, err := newFilePolicy(config.PolicyFile)
+		if err != nil {
+			dberr := store.Close()
+			return nil, fmt.Errorf("failed to load URL policy: %w", errors.Join(err, dberr))
+		}
+		app.policy = policy
+		log.Info("URL policy loaded", "path", config.PolicyFile)
+	}
+
+	// Bring the database schema up to date unless migrations are run separately
+	if !config.SkipMigrations {
+		if err := store.Migrate(ctx); err != nil {
+			dberr := store.Close()
+			return nil, fmt.Errorf("failed to migrate database: %w", errors.Join(err, dberr))
+		}
+	}
+
+	app.urls = newURLCache(config.URLCacheSize, config.URLCacheTTL, config.URLCacheNegativeTTL)
+	app.metrics = newMetrics(app)
+	app.clicks = newClickQueue(app, config.ClickQueueSize, config.ClickBatchSize, config.ClickFlushInterval)
+
+	if err := app.setupTracing(ctx); err != nil {
+		dberr := store.Close()
+		return nil, fmt.Errorf("failed to set up tracing: %w", errors.Join(err, dberr))
 	}
 
 	// Apply functional options
 	for _, opt := range opts {
 		if err := opt(app); err != nil {
-			dberr := db.Close()
+			dberr := store.Close()
 			return nil, fmt.Errorf("failed to apply option: %w", errors.Join(err, dberr))
 		}
 	}
 
 	// If no custom routes provided, set up default routes
 	if app.server.Handler == nil {
-		app.server.Handler = corsMiddleware(app.setupRoutes())
+		mux := app.setupRoutes()
+		app.server.Handler = app.tracingMiddleware(mux, app.requestLogMiddleware(
+			app.metricsMiddleware(mux, corsMiddleware(app.authMiddleware(mux, app.rateLimitMiddleware(mux)))),
+		))
 	}
 
 	return app, nil
@@ -173,8 +334,9 @@ func NewApp(ctx context.Context, config *Config, opts ...AppOption) (*App, error
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
 
 		// Handle preflight requests
 		if r.Method == "OPTIONS" {
@@ -196,35 +358,67 @@ func (a *App) setupRoutes() *http.ServeMux {
 			http.NotFound(w, r)
 			return
 		}
-		log.Info("Homepage requested", "method", r.Method, "path", r.URL.Path)
 		http.ServeContent(w, r, "index.html", time.Time{}, bytes.NewReader(indexHTML))
 	})
 
 	// Health check endpoint
 	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
-		log.Info("Health check requested", "method", r.Method, "path", r.URL.Path)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		if _, err := fmt.Fprintf(w, `{"status":"ok","version":"%s", "buildTime":"%s", "commit":"%s"}`, Version, BuildTime, Commit); err != nil {
-			log.Error("Failed to write health response", "error", err)
-		} else {
-			log.Info("Health check succeeded", "status", "ok", "version", Version)
-		}
+		stats := a.clicks.Stats()
+		writeJSON(w, http.StatusOK, HealthResponse{
+			Status:     "ok",
+			Version:    Version,
+			BuildTime:  BuildTime,
+			Commit:     Commit,
+			ClickQueue: &stats,
+			URLCache:   a.urls.Stats(),
+		})
 	})
 
+	// Liveness and readiness probes
+	mux.HandleFunc("GET /livez", a.handleLivez)
+	mux.HandleFunc("GET /readyz", a.handleReadyz)
+
+	// Prometheus metrics
+	mux.Handle("GET /metrics", a.metrics.handler())
+
 	// URL shortener endpoints
 	mux.HandleFunc("POST /s", a.handleShorten)
 	mux.HandleFunc("GET /s", a.handleShortenGET)
 	mux.HandleFunc("GET /{shortCode}/stats", a.handleStats)
+	mux.HandleFunc("GET /{shortCode}/stats/timeseries", a.handleTimeSeries)
+	mux.HandleFunc("GET /{shortCode}/stats/breakdown", a.handleBreakdown)
 	mux.HandleFunc("GET /{shortCode}/qr", a.handleQR)
 	mux.HandleFunc("GET /{shortCode}", a.handleRedirect)
+	mux.HandleFunc("POST /{shortCode}", a.handleUnlock)
+	mux.HandleFunc("PATCH /{shortCode}", a.handleUpdate)
+	mux.HandleFunc("DELETE /{shortCode}", a.handleDelete)
+	mux.HandleFunc("POST /{shortCode}/disable", a.handleDisable)
+	mux.HandleFunc("POST /{shortCode}/enable", a.handleEnable)
+	mux.HandleFunc("GET /{shortCode}/history", a.handleHistory)
 
 	return mux
 }
 
+// runCommand runs a management command such as `ul keys create <name>`
+func (a *App) runCommand(args []string) error {
+	switch args[0] {
+	case "keys":
+		return a.runKeysCommand(args[1:])
+	case "migrate":
+		return a.runMigrateCommand(args[1:])
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
 func (a *App) Start(ctx context.Context) error {
 	log.Info("Starting HTTP server", "address", a.server.Addr, "version", Version)
 
+	if policy, ok := a.policy.(*filePolicy); ok && a.config.PolicyReloadInterval > 0 {
+		go policy.watch(ctx, a.config.PolicyReloadInterval)
+	}
+	go a.salts.watch(ctx, a.store)
+
 	// Start server in a goroutine
 	errChan := make(chan error, 1)
 	go func() {
@@ -44,7 +44,7 @@ func TestNewApp_WithRoutes(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed to create app with custom routes: %v", err)
 	}
-	defer app.db.Close()
+	defer app.store.Close()
 
 	if app.server.Handler != customMux {
 		t.Error("Expected custom mux to be set as handler")
@@ -66,7 +66,7 @@ func TestWithRoutes_NilMux(t *testing.T) {
 
 func TestSetupRoutes(t *testing.T) {
 	app := setupTestApp(t)
-	defer app.db.Close()
+	defer app.store.Close()
 
 	mux := app.setupRoutes()
 
@@ -82,7 +82,7 @@ func TestSetupRoutes(t *testing.T) {
 
 func TestSetupRoutes_HealthEndpoint(t *testing.T) {
 	app := setupTestApp(t)
-	defer app.db.Close()
+	defer app.store.Close()
 
 	mux := app.setupRoutes()
 
@@ -102,7 +102,7 @@ func TestSetupRoutes_HealthEndpoint(t *testing.T) {
 
 func TestHealthEndpoint_JSONResponse(t *testing.T) {
 	app := setupTestApp(t)
-	defer app.db.Close()
+	defer app.store.Close()
 
 	req := httptest.NewRequest("GET", "/health", nil)
 	rec := httptest.NewRecorder()
@@ -0,0 +1,470 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryStore is a Store keeping everything in process memory, for tests and
+// ephemeral deployments. Data is lost when the process exits and isn't shared
+// between replicas.
+type memoryStore struct {
+	mu sync.Mutex
+
+	urls       map[int64]*memoryURL
+	shortCodes map[string]int64
+	reuseKeys  map[string]int64
+	lastURLID  int64
+
+	clicks    []memoryClick
+	revisions map[int64][]URLRevision
+
+	apiKeys   []memoryAPIKey
+	lastKeyID int64
+
+	salts map[string][]byte
+}
+
+// memoryURL is a stored URL with the columns URLRecord doesn't expose
+type memoryURL struct {
+	URLRecord
+	isAlias       bool
+	botClicks     int64
+	redirectChain []string
+	reuseKey      string
+}
+
+type memoryClick struct {
+	urlID     int64
+	time      time.Time
+	userAgent string
+	referer   string
+	visitor   string
+	isBot     bool
+}
+
+type memoryAPIKey struct {
+	APIKey
+	hash string
+}
+
+// newMemoryStore creates an empty memoryStore
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		urls:       make(map[int64]*memoryURL),
+		shortCodes: make(map[string]int64),
+		reuseKeys:  make(map[string]int64),
+		revisions:  make(map[int64][]URLRevision),
+		salts:      make(map[string][]byte),
+	}
+}
+
+// now returns the current time with the precision of the SQL backends
+func (s *memoryStore) now() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
+
+// lookup returns the URL stored under shortCode
+func (s *memoryStore) lookup(shortCode string) (*memoryURL, error) {
+	id, ok := s.shortCodes[shortCode]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return s.urls[id], nil
+}
+
+// clearReuseKey stops new requests from sharing a URL
+func (s *memoryStore) clearReuseKey(u *memoryURL) {
+	if u.reuseKey != "" {
+		delete(s.reuseKeys, u.reuseKey)
+		u.reuseKey = ""
+	}
+}
+
+// record returns a copy of a stored URL's record that callers may keep
+func (u *memoryURL) record() *URLRecord {
+	record := u.URLRecord
+	return &record
+}
+
+func (s *memoryStore) CreateURL(ctx context.Context, url *NewURL) (*URLRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	isAlias := url.ShortCode != ""
+	if _, ok := s.shortCodes[url.ShortCode]; ok && isAlias {
+		return nil, false, fmt.Errorf("%w: %q is already in use", ErrAliasConflict, url.ShortCode)
+	}
+	if id, ok := s.reuseKeys[url.ReuseKey]; ok && url.ReuseKey != "" {
+		return s.urls[id].record(), false, nil
+	}
+
+	s.lastURLID++
+	stored := &memoryURL{
+		URLRecord: URLRecord{
+			ID:           s.lastURLID,
+			ShortCode:    url.ShortCode,
+			OriginalURL:  url.OriginalURL,
+			CreatedAt:    s.now(),
+			ExpiresAt:    url.ExpiresAt,
+			PasswordHash: url.PasswordHash,
+		},
+		isAlias:       isAlias,
+		redirectChain: url.RedirectChain,
+		reuseKey:      url.ReuseKey,
+	}
+	if url.MaxClicks != 0 {
+		maxClicks := url.MaxClicks
+		stored.MaxClicks = &maxClicks
+	}
+	if url.APIKeyID != 0 {
+		apiKeyID := url.APIKeyID
+		stored.APIKeyID = &apiKeyID
+	}
+	if !isAlias {
+		stored.ShortCode = generateShortCode(stored.ID)
+	}
+
+	s.urls[stored.ID] = stored
+	s.shortCodes[stored.ShortCode] = stored.ID
+	if stored.reuseKey != "" {
+		s.reuseKeys[stored.reuseKey] = stored.ID
+	}
+
+	return stored.record(), true, nil
+}
+
+func (s *memoryStore) GetURL(ctx context.Context, shortCode string) (*URLRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.lookup(shortCode)
+	if err != nil {
+		return nil, err
+	}
+	return u.record(), nil
+}
+
+func (s *memoryStore) UpdateURL(ctx context.Context, shortCode, destination string, chain []string, actor string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.lookup(shortCode)
+	if err != nil {
+		return false, err
+	}
+	if u.OriginalURL == destination {
+		return false, nil
+	}
+
+	revision := URLRevision{PreviousURL: u.OriginalURL, NewURL: destination, ChangedAt: s.now(), Actor: actor}
+	s.revisions[u.ID] = append(s.revisions[u.ID], revision)
+	u.OriginalURL = destination
+	u.redirectChain = chain
+	s.clearReuseKey(u)
+
+	return true, nil
+}
+
+func (s *memoryStore) SetDisabled(ctx context.Context, shortCode string, disabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.lookup(shortCode)
+	if err != nil {
+		return err
+	}
+	u.Disabled = disabled
+	if disabled {
+		s.clearReuseKey(u)
+	}
+
+	return nil
+}
+
+func (s *memoryStore) DeleteURL(ctx context.Context, shortCode string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.lookup(shortCode)
+	if err != nil {
+		return err
+	}
+
+	s.clicks = slices.DeleteFunc(s.clicks, func(c memoryClick) bool { return c.urlID == u.ID })
+	delete(s.revisions, u.ID)
+	s.clearReuseKey(u)
+	delete(s.shortCodes, shortCode)
+	delete(s.urls, u.ID)
+
+	return nil
+}
+
+func (s *memoryStore) GetRevisions(ctx context.Context, urlID int64) ([]URLRevision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := s.revisions[urlID]
+	revisions := make([]URLRevision, len(stored))
+	for i, rev := range stored {
+		revisions[len(stored)-1-i] = rev
+	}
+
+	return revisions, nil
+}
+
+func (s *memoryStore) TrackClick(ctx context.Context, click *Click) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.urls[click.URLID]
+	if !ok || u.IsExhausted() {
+		return ErrClickLimitReached
+	}
+
+	s.addClick(u, click, s.now())
+
+	return nil
+}
+
+func (s *memoryStore) WriteClicks(ctx context.Context, clicks []*Click) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, click := range clicks {
+		// Clicks on links deleted since they were queued are dropped
+		if u, ok := s.urls[click.URLID]; ok {
+			s.addClick(u, click, click.Time.UTC().Truncate(time.Second))
+		}
+	}
+
+	return nil
+}
+
+// addClick records a click on u at the given time and updates its counters
+func (s *memoryStore) addClick(u *memoryURL, click *Click, at time.Time) {
+	s.clicks = append(s.clicks, memoryClick{
+		urlID:     u.ID,
+		time:      at,
+		userAgent: click.UserAgent,
+		referer:   click.Referer,
+		visitor:   click.VisitorHash,
+		isBot:     click.IsBot,
+	})
+
+	if click.IsBot {
+		u.botClicks++
+		return
+	}
+	u.Clicks++
+	if u.LastClickedAt == nil || at.After(*u.LastClickedAt) {
+		u.LastClickedAt = &at
+	}
+}
+
+func (s *memoryStore) GetStats(ctx context.Context, shortCode string) (*URLStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.lookup(shortCode)
+	if err != nil {
+		return nil, err
+	}
+
+	return &URLStats{
+		ShortCode:         u.ShortCode,
+		OriginalURL:       u.OriginalURL,
+		CreatedAt:         u.CreatedAt,
+		TotalClicks:       u.Clicks,
+		BotClicks:         u.botClicks,
+		LastClickedAt:     u.LastClickedAt,
+		ExpiresAt:         u.ExpiresAt,
+		MaxClicks:         u.MaxClicks,
+		PasswordProtected: u.PasswordHash != "",
+		Disabled:          u.Disabled,
+		RedirectChain:     slices.Clone(u.redirectChain),
+	}, nil
+}
+
+// matchingClicks calls fn with every click on urlID from from (inclusive) to
+// to (exclusive), skipping bots unless includeBots is set
+func (s *memoryStore) matchingClicks(urlID int64, from, to *time.Time, includeBots bool, fn func(memoryClick)) {
+	for _, c := range s.clicks {
+		if c.urlID != urlID || (c.isBot && !includeBots) ||
+			(from != nil && c.time.Before(*from)) || (to != nil && !c.time.Before(*to)) {
+			continue
+		}
+		fn(c)
+	}
+}
+
+func (s *memoryStore) CountClicks(ctx context.Context, urlID int64, interval string, from, to time.Time, includeBots bool) (map[time.Time]int64, error) {
+	spec, ok := timeSeriesIntervals[interval]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown interval %q", ErrInvalidTimeSeries, interval)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := make(map[time.Time]int64)
+	s.matchingClicks(urlID, &from, &to, includeBots, func(c memoryClick) {
+		counts[spec.truncate(c.time)]++
+	})
+
+	return counts, nil
+}
+
+func (s *memoryStore) ClickSources(ctx context.Context, urlID int64, from, to *time.Time, includeBots bool) ([]ClickSource, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	type key struct{ userAgent, referer string }
+	counts := make(map[key]int64)
+	s.matchingClicks(urlID, from, to, includeBots, func(c memoryClick) {
+		counts[key{c.userAgent, c.referer}]++
+	})
+
+	sources := make([]ClickSource, 0, len(counts))
+	for k, clicks := range counts {
+		sources = append(sources, ClickSource{UserAgent: k.userAgent, Referer: k.referer, Clicks: clicks})
+	}
+
+	return sources, nil
+}
+
+func (s *memoryStore) UniqueVisitors(ctx context.Context, shortCode string, since time.Time) ([]DailyVisitors, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.lookup(shortCode)
+	if err != nil {
+		return []DailyVisitors{}, nil
+	}
+
+	days := make(map[string]map[string]bool)
+	s.matchingClicks(u.ID, &since, nil, false, func(c memoryClick) {
+		if c.visitor == "" {
+			return
+		}
+		day := c.time.Format(time.DateOnly)
+		if days[day] == nil {
+			days[day] = make(map[string]bool)
+		}
+		days[day][c.visitor] = true
+	})
+
+	visitors := make([]DailyVisitors, 0, len(days))
+	for day, hashes := range days {
+		visitors = append(visitors, DailyVisitors{Date: day, Visitors: int64(len(hashes))})
+	}
+	sort.Slice(visitors, func(i, j int) bool { return visitors[i].Date < visitors[j].Date })
+
+	return visitors, nil
+}
+
+func (s *memoryStore) VisitorSalt(ctx context.Context, day string, salt []byte) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stored, ok := s.salts[day]; ok {
+		salt = stored
+	}
+	for other := range s.salts {
+		if other > day {
+			return nil, fmt.Errorf("%w: %s", ErrPastVisitorSalt, day)
+		}
+	}
+	s.salts[day] = salt
+
+	for other := range s.salts {
+		if other < day {
+			delete(s.salts, other)
+		}
+	}
+
+	return salt, nil
+}
+
+func (s *memoryStore) CreateAPIKey(ctx context.Context, name, keyHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range s.apiKeys {
+		if key.Name == name || key.hash == keyHash {
+			return ErrAPIKeyExists
+		}
+	}
+
+	s.lastKeyID++
+	s.apiKeys = append(s.apiKeys, memoryAPIKey{
+		APIKey: APIKey{ID: s.lastKeyID, Name: name, CreatedAt: s.now()},
+		hash:   keyHash,
+	})
+
+	return nil
+}
+
+func (s *memoryStore) RevokeAPIKey(ctx context.Context, name string, at time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.apiKeys {
+		key := &s.apiKeys[i]
+		if key.Name == name && key.RevokedAt == nil {
+			revokedAt := at.UTC().Truncate(time.Second)
+			key.RevokedAt = &revokedAt
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (s *memoryStore) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var keys []APIKey
+	for _, key := range s.apiKeys {
+		keys = append(keys, key.APIKey)
+	}
+
+	return keys, nil
+}
+
+func (s *memoryStore) LookupAPIKey(ctx context.Context, keyHash string) (*APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range s.apiKeys {
+		if key.hash == keyHash && key.RevokedAt == nil {
+			apiKey := APIKey{ID: key.ID, Name: key.Name, CreatedAt: key.CreatedAt}
+			return &apiKey, nil
+		}
+	}
+
+	return nil, ErrInvalidAPIKey
+}
+
+// Migrate does nothing, as memory has no schema to upgrade
+func (s *memoryStore) Migrate(ctx context.Context) error {
+	return nil
+}
+
+// SchemaVersion always reports the latest version
+func (s *memoryStore) SchemaVersion(ctx context.Context) (int, error) {
+	return schemaVersion, nil
+}
+
+func (s *memoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
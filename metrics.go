@@ -0,0 +1,159 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Outcomes of a request for a short link, as counted by ul_redirects_total
+const (
+	outcomeRedirected       = "redirected"
+	outcomeNotFound         = "not_found"
+	outcomeExpired          = "expired"
+	outcomeDisabled         = "disabled"
+	outcomeClickLimit       = "click_limit"
+	outcomeBlocked          = "blocked"
+	outcomePasswordRequired = "password_required"
+	outcomeWrongPassword    = "wrong_password"
+	outcomePreviewed        = "previewed"
+)
+
+// metrics holds the Prometheus collectors of an App. Each App has its own
+// registry so that several can exist in one process, as they do in tests.
+type metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	redirects       *prometheus.CounterVec
+	qrDuration      prometheus.Histogram
+	queryDuration   *prometheus.HistogramVec
+}
+
+// newMetrics registers the collectors for a, including ones reading the
+// click queue and URL cache counters when scraped. a.urls must already be set.
+func newMetrics(a *App) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ul_http_requests_total",
+			Help: "HTTP requests by route and status code.",
+		}, []string{"route", "code"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "ul_http_request_duration_seconds",
+			Help:    "HTTP request latency by route.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route"}),
+		redirects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ul_redirects_total",
+			Help: "Requests for short links by outcome.",
+		}, []string{"outcome"}),
+		qrDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "ul_qr_generation_duration_seconds",
+			Help:    "Time taken to generate and encode QR codes.",
+			Buckets: prometheus.ExponentialBuckets(0.0005, 2, 12),
+		}),
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "ul_db_query_duration_seconds",
+			Help:    "Database latency by operation.",
+			Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14),
+		}, []string{"query"}),
+	}
+
+	// Pre-create the outcomes so they are exported before they first happen
+	for _, outcome := range []string{
+		outcomeRedirected, outcomeNotFound, outcomeExpired, outcomeDisabled,
+		outcomeClickLimit, outcomeBlocked, outcomePasswordRequired, outcomeWrongPassword, outcomePreviewed,
+	} {
+		m.redirects.WithLabelValues(outcome)
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.redirects,
+		m.qrDuration,
+		m.queryDuration,
+	)
+
+	type valueFunc struct {
+		name, help string
+		value      func() float64
+	}
+
+	gauges := []valueFunc{
+		{"ul_click_queue_depth", "Clicks waiting to be written.",
+			func() float64 { return float64(a.clicks.Stats().Depth) }},
+		{"ul_click_queue_capacity", "Clicks the queue can hold before dropping new ones.",
+			func() float64 { return float64(a.clicks.Stats().Capacity) }},
+	}
+	counters := []valueFunc{
+		{"ul_clicks_enqueued_total", "Clicks added to the queue.",
+			func() float64 { return float64(a.clicks.Stats().Enqueued) }},
+		{"ul_clicks_dropped_total", "Clicks dropped because the queue was full.",
+			func() float64 { return float64(a.clicks.Stats().Dropped) }},
+		{"ul_clicks_written_total", "Queued clicks written to the database.",
+			func() float64 { return float64(a.clicks.Stats().Written) }},
+		{"ul_clicks_failed_total", "Queued clicks lost to failed writes.",
+			func() float64 { return float64(a.clicks.Stats().Failed) }},
+	}
+	if a.urls != nil {
+		counters = append(counters,
+			valueFunc{"ul_url_cache_hits_total", "Short code lookups served from the cache.",
+				func() float64 { return float64(a.urls.Stats().Hits) }},
+			valueFunc{"ul_url_cache_misses_total", "Short code lookups that went to the database.",
+				func() float64 { return float64(a.urls.Stats().Misses) }},
+			valueFunc{"ul_url_cache_evictions_total", "Short codes evicted to make room in the cache.",
+				func() float64 { return float64(a.urls.Stats().Evictions) }},
+		)
+	}
+
+	for _, gauge := range gauges {
+		m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: gauge.name, Help: gauge.help}, gauge.value))
+	}
+	for _, counter := range counters {
+		m.registry.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{Name: counter.name, Help: counter.help}, counter.value))
+	}
+
+	return m
+}
+
+// handler serves the registered metrics in the Prometheus text format
+func (m *metrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// redirect counts a request for a short link with the given outcome
+func (m *metrics) redirect(outcome string) {
+	m.redirects.WithLabelValues(outcome).Inc()
+}
+
+// observeQuery records the time since start for a database operation,
+// typically as `defer a.metrics.observeQuery("name", time.Now())`
+func (m *metrics) observeQuery(query string, start time.Time) {
+	m.queryDuration.WithLabelValues(query).Observe(time.Since(start).Seconds())
+}
+
+// metricsMiddleware counts requests and their latency by the route pattern
+// they match in mux, including requests rejected before reaching it
+func (a *App) metricsMiddleware(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unmatched"
+		if _, pattern := mux.Handler(r); pattern != "" {
+			route = pattern
+		}
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+
+		a.metrics.requests.WithLabelValues(route, strconv.Itoa(recorder.statusCode())).Inc()
+		a.metrics.requestDuration.WithLabelValues(route).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	resp, err := app.createShortURL(context.Background(), &ShortenRequest{URL: "https://www.example.com/metrics"})
+	if err != nil {
+		t.Fatalf("Failed to create short URL: %v", err)
+	}
+
+	for _, path := range []string{"/" + resp.ShortCode, "/" + resp.ShortCode, "/nonexistent", "/" + resp.ShortCode + "/qr"} {
+		app.server.Handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	rec := httptest.NewRecorder()
+	app.server.Handler.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	body, _ := io.ReadAll(rec.Body)
+	for _, expected := range []string{
+		`ul_http_requests_total{code="301",route="GET /{shortCode}"} 2`,
+		`ul_http_requests_total{code="404",route="GET /{shortCode}"} 1`,
+		`ul_http_requests_total{code="200",route="GET /{shortCode}/qr"} 1`,
+		`ul_http_request_duration_seconds_count{route="GET /{shortCode}"} 3`,
+		`ul_redirects_total{outcome="redirected"} 2`,
+		`ul_redirects_total{outcome="not_found"} 1`,
+		`ul_redirects_total{outcome="expired"} 0`,
+		`ul_qr_generation_duration_seconds_count 1`,
+		`ul_db_query_duration_seconds_count{query="get_url"} 4`,
+		`ul_clicks_enqueued_total 2`,
+		`ul_click_queue_capacity 10000`,
+	} {
+		if !strings.Contains(string(body), expected) {
+			t.Errorf("Expected metrics to contain %q", expected)
+		}
+	}
+}
@@ -0,0 +1,450 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:embed migrations/sqlite/*.sql migrations/postgres/*.sql
+var migrationFiles embed.FS
+
+const (
+	// migrationLockWait is how long a migrator waits for another one to finish
+	migrationLockWait = time.Minute
+
+	// migrationLockStale is how old a lock must be before it's assumed to be
+	// left over from a migrator that crashed
+	migrationLockStale = 10 * time.Minute
+
+	migrationLockPoll = 500 * time.Millisecond
+)
+
+// migrationFileName matches migration files such as 0002_link_management.up.sql
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// ErrMigrationLocked is returned when another migrator holds the lock for too long
+var ErrMigrationLocked = errors.New("migrations are locked by another process")
+
+// migration is one versioned schema change with the SQL to apply and revert it
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+// MigrationStatus reports whether a migration has been applied to the database
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// loadMigrations reads the migrations in the root of fsys, ordered by version.
+// Every migration needs both an up and a down file.
+func loadMigrations(fsys fs.FS) ([]migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*migration)
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version, name: match[2]}
+			byVersion[version] = m
+		}
+		if m.name != match[2] {
+			return nil, fmt.Errorf("migration %d has files named %q and %q", version, m.name, match[2])
+		}
+
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %q: %w", entry.Name(), err)
+		}
+		if match[3] == "up" {
+			m.up = string(data)
+		} else {
+			m.down = string(data)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", m.version, m.name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+
+	return migrations, nil
+}
+
+// loadEmbeddedMigrations loads the migrations in migrations/<dir>
+func loadEmbeddedMigrations(dir string) []migration {
+	fsys, err := fs.Sub(migrationFiles, "migrations/"+dir)
+	if err != nil {
+		panic(err)
+	}
+	migrations, err := loadMigrations(fsys)
+	if err != nil {
+		panic(err)
+	}
+	return migrations
+}
+
+// schemaVersion is the latest migration this release knows about. Every
+// dialect has the same migration versions.
+var schemaVersion = sqliteDialect.migrations[len(sqliteDialect.migrations)-1].version
+
+// migrator applies and reverts migrations, recording them in the
+// schema_migrations table. Only one migrator at a time can change the
+// schema, across every replica sharing the database.
+type migrator struct {
+	db         *sql.DB
+	dialect    *sqlDialect
+	migrations []migration
+	owner      string
+}
+
+// newMigrator creates a migrator applying migrations written for dialect
+func newMigrator(db *sql.DB, dialect *sqlDialect, migrations []migration) *migrator {
+	id := make([]byte, 8)
+	// crypto/rand.Read never returns an error
+	rand.Read(id)
+	hostname, _ := os.Hostname()
+
+	return &migrator{
+		db:         db,
+		dialect:    dialect,
+		migrations: migrations,
+		owner:      fmt.Sprintf("%s/%d/%s", hostname, os.Getpid(), hex.EncodeToString(id)),
+	}
+}
+
+// init creates the tables used to track and lock migrations
+func (m *migrator) init(ctx context.Context) error {
+	_, err := m.db.ExecContext(ctx, m.dialect.migrationTables)
+	if err != nil {
+		return fmt.Errorf("failed to create migration tables: %w", err)
+	}
+	return nil
+}
+
+// lock waits until no other migrator holds the lock and takes it. Locks older
+// than migrationLockStale are taken over.
+func (m *migrator) lock(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, migrationLockWait)
+	defer cancel()
+
+	for {
+		now := time.Now()
+		_, err := m.db.ExecContext(ctx,
+			m.dialect.rebind("DELETE FROM schema_migrations_lock WHERE id = 1 AND locked_at < ?"),
+			m.dialect.timeArg(now.Add(-migrationLockStale)),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to clear stale migration lock: %w", err)
+		}
+
+		_, err = m.db.ExecContext(ctx,
+			m.dialect.rebind("INSERT INTO schema_migrations_lock (id, owner, locked_at) VALUES (1, ?, ?)"),
+			m.owner, m.dialect.timeArg(now),
+		)
+		if err == nil {
+			return nil
+		}
+		if !isUniqueViolation(err) {
+			return fmt.Errorf("failed to take migration lock: %w", err)
+		}
+
+		log.Info("Waiting for migration lock")
+		select {
+		case <-ctx.Done():
+			return ErrMigrationLocked
+		case <-time.After(migrationLockPoll):
+		}
+	}
+}
+
+// unlock releases the lock if this migrator still holds it
+func (m *migrator) unlock() {
+	_, err := m.db.Exec(m.dialect.rebind("DELETE FROM schema_migrations_lock WHERE id = 1 AND owner = ?"), m.owner)
+	if err != nil {
+		log.Error("Failed to release migration lock", "error", err)
+	}
+}
+
+// applied returns when each applied migration was applied, by version
+func (m *migrator) applied(ctx context.Context) (map[int]time.Time, error) {
+	rows, err := m.db.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan migration: %w", err)
+		}
+		applied[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	return applied, nil
+}
+
+// Status lists every known migration and when it was applied, if it was
+func (m *migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	if err := m.init(ctx); err != nil {
+		return nil, err
+	}
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		status := MigrationStatus{Version: mig.version, Name: mig.name}
+		if appliedAt, ok := applied[mig.version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// migrationSteps complete the up migrations of the same name with data
+// changes that can't be written in SQL. They run after the migration's SQL,
+// in its transaction.
+var migrationSteps = map[string]func(ctx context.Context, tx *sql.Tx, dialect *sqlDialect) error{
+	"reuse_key": backfillReuseKeys,
+}
+
+// backfillReuseKeys sets the reuse key of existing plain links, normalized
+// like those of new links. The oldest of any links sharing a key keeps it.
+func backfillReuseKeys(ctx context.Context, tx *sql.Tx, dialect *sqlDialect) error {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, original_url, COALESCE(api_key_id, 0) FROM urls
+		WHERE NOT is_alias AND expires_at IS NULL AND max_clicks IS NULL AND password_hash = '' AND NOT disabled
+			AND redirect_chain = ''
+			AND NOT EXISTS (SELECT 1 FROM url_revisions WHERE url_revisions.url_id = urls.id)
+		ORDER BY id
+	`)
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	keys := make(map[string]int64)
+	var order []string
+	for rows.Next() {
+		var id, apiKeyID int64
+		var destination string
+		if err := rows.Scan(&id, &destination, &apiKeyID); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan URL: %w", err)
+		}
+
+		key := reuseKey(destination, apiKeyID)
+		if _, ok := keys[key]; !ok {
+			keys[key] = id
+			order = append(order, key)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	for _, key := range order {
+		if _, err := tx.ExecContext(ctx, dialect.rebind("UPDATE urls SET reuse_key = ? WHERE id = ?"), key, keys[key]); err != nil {
+			return fmt.Errorf("failed to set reuse key: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// run executes a migration's SQL and updates schema_migrations in one transaction
+func (m *migrator) run(ctx context.Context, mig migration, up bool) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	script, record, args := mig.down, "DELETE FROM schema_migrations WHERE version = ?", []any{mig.version}
+	if up {
+		script, record, args = mig.up, "INSERT INTO schema_migrations (version, name) VALUES (?, ?)", []any{mig.version, mig.name}
+	}
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return fmt.Errorf("migration %d_%s failed: %w", mig.version, mig.name, err)
+	}
+	if step, ok := migrationSteps[mig.name]; ok && up {
+		if err := step(ctx, tx, m.dialect); err != nil {
+			return fmt.Errorf("migration %d_%s failed: %w", mig.version, mig.name, err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, m.dialect.rebind(record), args...); err != nil {
+		return fmt.Errorf("failed to record migration %d_%s: %w", mig.version, mig.name, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (m *migrator) Up(ctx context.Context) (int, error) {
+	if err := m.init(ctx); err != nil {
+		return 0, err
+	}
+	if err := m.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer m.unlock()
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, mig := range m.migrations {
+		if _, ok := applied[mig.version]; ok {
+			continue
+		}
+
+		if err := m.run(ctx, mig, true); err != nil {
+			return count, err
+		}
+		log.Info("Migration applied", "version", mig.version, "name", mig.name)
+		count++
+	}
+
+	return count, nil
+}
+
+// Down reverts the latest steps applied migrations, newest first, and returns
+// how many it reverted
+func (m *migrator) Down(ctx context.Context, steps int) (int, error) {
+	if err := m.init(ctx); err != nil {
+		return 0, err
+	}
+	if err := m.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer m.unlock()
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	versions := make([]int, 0, len(applied))
+	for version := range applied {
+		versions = append(versions, version)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+
+	known := make(map[int]migration, len(m.migrations))
+	for _, mig := range m.migrations {
+		known[mig.version] = mig
+	}
+
+	count := 0
+	for _, version := range versions[:min(steps, len(versions))] {
+		mig, ok := known[version]
+		if !ok {
+			return count, fmt.Errorf("migration %d was applied by a newer release and can't be reverted by this one", version)
+		}
+
+		if err := m.run(ctx, mig, false); err != nil {
+			return count, err
+		}
+		log.Info("Migration reverted", "version", mig.version, "name", mig.name)
+		count++
+	}
+
+	return count, nil
+}
+
+// runMigrateCommand handles `ul migrate status|up|down [steps]`
+func (a *App) runMigrateCommand(args []string) error {
+	const usage = "usage: ul migrate status | ul migrate up | ul migrate down [steps]"
+
+	store, ok := a.store.(*sqlStore)
+	if !ok {
+		return fmt.Errorf("the configured store has no schema to migrate")
+	}
+
+	ctx := context.Background()
+	m := newMigrator(store.db, store.dialect, store.dialect.migrations)
+
+	switch {
+	case len(args) == 1 && args[0] == "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = "applied " + status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d\t%s\t%s\n", status.Version, status.Name, applied)
+		}
+	case len(args) == 1 && args[0] == "up":
+		count, err := m.Up(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("applied %d migrations\n", count)
+	case (len(args) == 1 || len(args) == 2) && args[0] == "down":
+		steps := 1
+		if len(args) == 2 {
+			var err error
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("steps must be a positive number")
+			}
+		}
+		count, err := m.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("reverted %d migrations\n", count)
+	default:
+		return fmt.Errorf(usage)
+	}
+
+	return nil
+}
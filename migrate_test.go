@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// openMigrationTestDB opens an empty in-memory database, separate from the one
+// shared by setupTestApp
+func openMigrationTestDB(t *testing.T, name string) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("libsql", "file:"+name+"?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	t.Helper()
+
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&count)
+	if err != nil {
+		t.Fatalf("Failed to look up table %s: %v", name, err)
+	}
+	return count > 0
+}
+
+var testMigrations = fstest.MapFS{
+	"0001_widgets.up.sql":   {Data: []byte("CREATE TABLE widgets (id INTEGER PRIMARY KEY);")},
+	"0001_widgets.down.sql": {Data: []byte("DROP TABLE widgets;")},
+	"0002_gadgets.up.sql":   {Data: []byte("CREATE TABLE gadgets (id INTEGER PRIMARY KEY);")},
+	"0002_gadgets.down.sql": {Data: []byte("DROP TABLE gadgets;")},
+}
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations(testMigrations)
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+	if len(migrations) != 2 || migrations[0].version != 1 || migrations[1].name != "gadgets" {
+		t.Errorf("Expected widgets then gadgets, got %+v", migrations)
+	}
+
+	tests := map[string]fstest.MapFS{
+		"missing down": {"0001_widgets.up.sql": {Data: []byte("SELECT 1;")}},
+		"bad name":     {"widgets.sql": {Data: []byte("SELECT 1;")}},
+		"name mismatch": {
+			"0001_widgets.up.sql":   {Data: []byte("SELECT 1;")},
+			"0001_gadgets.down.sql": {Data: []byte("SELECT 1;")},
+		},
+	}
+	for name, fsys := range tests {
+		if _, err := loadMigrations(fsys); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	if len(sqliteDialect.migrations) == 0 || schemaVersion != sqliteDialect.migrations[len(sqliteDialect.migrations)-1].version {
+		t.Errorf("Expected schemaVersion to be the latest embedded migration, got %d", schemaVersion)
+	}
+
+	// Every dialect needs the same migrations for schemaVersion to hold
+	postgres := postgresDialect.migrations
+	if len(postgres) != len(sqliteDialect.migrations) {
+		t.Fatalf("Expected %d postgres migrations, got %d", len(sqliteDialect.migrations), len(postgres))
+	}
+	for i, mig := range sqliteDialect.migrations {
+		if postgres[i].version != mig.version || postgres[i].name != mig.name {
+			t.Errorf("Expected postgres migration %04d_%s, got %04d_%s", mig.version, mig.name, postgres[i].version, postgres[i].name)
+		}
+	}
+}
+
+func TestMigrator_UpDown(t *testing.T) {
+	ctx := context.Background()
+	db := openMigrationTestDB(t, "migrate_up_down")
+
+	migrations, err := loadMigrations(testMigrations)
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	// Only the first migration exists in an older release
+	count, err := newMigrator(db, sqliteDialect, migrations[:1]).Up(ctx)
+	if err != nil || count != 1 {
+		t.Fatalf("Expected 1 migration applied, got %d: %v", count, err)
+	}
+
+	m := newMigrator(db, sqliteDialect, migrations)
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get status: %v", err)
+	}
+	if len(statuses) != 2 || statuses[0].AppliedAt == nil || statuses[1].AppliedAt != nil {
+		t.Errorf("Expected only the first migration applied, got %+v", statuses)
+	}
+
+	count, err = m.Up(ctx)
+	if err != nil || count != 1 || !tableExists(t, db, "gadgets") {
+		t.Fatalf("Expected the second migration applied, got %d: %v", count, err)
+	}
+
+	// Running again is a no-op
+	if count, err := m.Up(ctx); err != nil || count != 0 {
+		t.Errorf("Expected no migrations applied, got %d: %v", count, err)
+	}
+
+	count, err = m.Down(ctx, 1)
+	if err != nil || count != 1 || tableExists(t, db, "gadgets") || !tableExists(t, db, "widgets") {
+		t.Fatalf("Expected only the second migration reverted, got %d: %v", count, err)
+	}
+
+	count, err = m.Down(ctx, 5)
+	if err != nil || count != 1 || tableExists(t, db, "widgets") {
+		t.Fatalf("Expected the first migration reverted, got %d: %v", count, err)
+	}
+
+	// A migration this release doesn't know about can't be reverted
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("Failed to apply migrations: %v", err)
+	}
+	if _, err := newMigrator(db, sqliteDialect, migrations[:1]).Down(ctx, 1); err == nil {
+		t.Error("Expected an error reverting an unknown migration")
+	}
+}
+
+func TestMigrator_FailedMigrationIsRolledBack(t *testing.T) {
+	ctx := context.Background()
+	db := openMigrationTestDB(t, "migrate_failed")
+
+	migrations, err := loadMigrations(fstest.MapFS{
+		"0001_broken.up.sql":   {Data: []byte("CREATE TABLE broken (id INTEGER PRIMARY KEY); INSERT INTO missing VALUES (1);")},
+		"0001_broken.down.sql": {Data: []byte("DROP TABLE broken;")},
+	})
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	m := newMigrator(db, sqliteDialect, migrations)
+	if _, err := m.Up(ctx); err == nil {
+		t.Fatal("Expected the migration to fail")
+	}
+	if tableExists(t, db, "broken") {
+		t.Error("Expected the failed migration to be rolled back")
+	}
+
+	statuses, err := m.Status(ctx)
+	if err != nil || statuses[0].AppliedAt != nil {
+		t.Errorf("Expected the failed migration to be pending, got %+v: %v", statuses, err)
+	}
+
+	// The lock is released after a failure
+	var locks int
+	if err := db.QueryRow("SELECT COUNT(*) FROM schema_migrations_lock").Scan(&locks); err != nil || locks != 0 {
+		t.Errorf("Expected the lock to be released, got %d: %v", locks, err)
+	}
+}
+
+func TestMigrator_Lock(t *testing.T) {
+	db := openMigrationTestDB(t, "migrate_lock")
+
+	migrations, err := loadMigrations(testMigrations)
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	other := newMigrator(db, sqliteDialect, migrations)
+	if err := other.init(context.Background()); err != nil {
+		t.Fatalf("Failed to create migration tables: %v", err)
+	}
+	if err := other.lock(context.Background()); err != nil {
+		t.Fatalf("Failed to take lock: %v", err)
+	}
+
+	// Another migrator waits for the lock
+	m := newMigrator(db, sqliteDialect, migrations)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := m.Up(ctx); !errors.Is(err, ErrMigrationLocked) {
+		t.Fatalf("Expected ErrMigrationLocked, got %v", err)
+	}
+	if tableExists(t, db, "widgets") {
+		t.Error("Expected no migrations applied without the lock")
+	}
+
+	// and gets it once released
+	other.unlock()
+	if count, err := m.Up(context.Background()); err != nil || count != 2 {
+		t.Fatalf("Expected 2 migrations applied, got %d: %v", count, err)
+	}
+
+	// A lock left behind by a crashed migrator is taken over once stale
+	if err := other.lock(context.Background()); err != nil {
+		t.Fatalf("Failed to take lock: %v", err)
+	}
+	_, err = db.Exec("UPDATE schema_migrations_lock SET locked_at = ?",
+		time.Now().Add(-migrationLockStale-time.Minute).UTC().Format(dbTimeFormat))
+	if err != nil {
+		t.Fatalf("Failed to age lock: %v", err)
+	}
+	if _, err := m.Down(context.Background(), 1); err != nil {
+		t.Errorf("Expected a stale lock to be taken over, got %v", err)
+	}
+}
+
+func TestMigrator_UpgradesExistingDatabases(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("baseline schema", func(t *testing.T) {
+		db := openMigrationTestDB(t, "migrate_baseline")
+
+		// Created by a release from before link management
+		_, err := db.Exec(sqliteDialect.migrations[0].up)
+		if err != nil {
+			t.Fatalf("Failed to create baseline schema: %v", err)
+		}
+		if _, err := db.Exec("INSERT INTO urls (short_code, original_url, clicks) VALUES ('abc123', 'https://example.com', 3)"); err != nil {
+			t.Fatalf("Failed to insert URL: %v", err)
+		}
+
+		if _, err := newMigrator(db, sqliteDialect, sqliteDialect.migrations).Up(ctx); err != nil {
+			t.Fatalf("Failed to migrate: %v", err)
+		}
+
+		var clicks int
+		var disabled bool
+		var reuseKey sql.NullString
+		err = db.QueryRow("SELECT clicks, disabled, reuse_key FROM urls WHERE short_code = 'abc123'").Scan(&clicks, &disabled, &reuseKey)
+		if err != nil || clicks != 3 || disabled {
+			t.Errorf("Expected the URL to be kept, got clicks=%d disabled=%v: %v", clicks, disabled, err)
+		}
+		if reuseKey.String != "https://example.com" {
+			t.Errorf("Expected the URL to be reusable, got reuse key %q", reuseKey.String)
+		}
+
+		// Reverting to the baseline keeps the URL
+		if _, err := newMigrator(db, sqliteDialect, sqliteDialect.migrations).Down(ctx, len(sqliteDialect.migrations)-1); err != nil {
+			t.Fatalf("Failed to revert: %v", err)
+		}
+		if err := db.QueryRow("SELECT clicks FROM urls WHERE short_code = 'abc123'").Scan(&clicks); err != nil || clicks != 3 {
+			t.Errorf("Expected the URL to be kept, got clicks=%d: %v", clicks, err)
+		}
+		if tableExists(t, db, "api_keys") {
+			t.Error("Expected api_keys to be dropped")
+		}
+	})
+}
+
+func TestMigrator_BackfillsReuseKeys(t *testing.T) {
+	ctx := context.Background()
+	db := openMigrationTestDB(t, "migrate_reuse_keys")
+
+	// Links shortened before reuse keys existed, two of them to the same
+	// destination written differently
+	if _, err := newMigrator(db, sqliteDialect, sqliteDialect.migrations[:2]).Up(ctx); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	_, err := db.Exec(`
+		INSERT INTO urls (short_code, original_url) VALUES
+			('old1', 'HTTP://Example.com:80/x'),
+			('old2', 'http://example.com/x'),
+			('old3', 'https://example.com/protected');
+		UPDATE urls SET password_hash = 'hash' WHERE short_code = 'old3';
+	`)
+	if err != nil {
+		t.Fatalf("Failed to insert URLs: %v", err)
+	}
+
+	if _, err := newMigrator(db, sqliteDialect, sqliteDialect.migrations).Up(ctx); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+
+	store := &sqlStore{db: db, dialect: sqliteDialect}
+	for _, destination := range []string{"http://example.com/x", "http://EXAMPLE.com:80/x"} {
+		record, created, err := store.CreateURL(ctx, &NewURL{OriginalURL: destination, ReuseKey: reuseKey(destination, 0)})
+		if err != nil || created || record.ShortCode != "old1" {
+			t.Errorf("Expected %s to reuse old1, got %+v (created %v): %v", destination, record, created, err)
+		}
+	}
+
+	destination := "https://example.com/protected"
+	record, created, err := store.CreateURL(ctx, &NewURL{OriginalURL: destination, ReuseKey: reuseKey(destination, 0)})
+	if err != nil || !created || record.ShortCode == "old3" {
+		t.Errorf("Expected protected links not to be reused, got %+v (created %v): %v", record, created, err)
+	}
+}
@@ -0,0 +1,24 @@
+-- Matches the SQLite schema of releases before migrations were introduced, so
+-- that both backends share schema versions
+CREATE TABLE urls (
+	id BIGSERIAL PRIMARY KEY,
+	short_code TEXT NOT NULL UNIQUE,
+	original_url TEXT NOT NULL,
+	created_at TIMESTAMP(0) NOT NULL DEFAULT (now() AT TIME ZONE 'UTC'),
+	clicks BIGINT NOT NULL DEFAULT 0,
+	last_clicked_at TIMESTAMP(0)
+);
+
+CREATE INDEX idx_original_url ON urls(original_url);
+CREATE INDEX idx_created_at ON urls(created_at);
+
+CREATE TABLE clicks (
+	id BIGSERIAL PRIMARY KEY,
+	url_id BIGINT NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+	clicked_at TIMESTAMP(0) NOT NULL DEFAULT (now() AT TIME ZONE 'UTC'),
+	user_agent TEXT,
+	referer TEXT
+);
+
+CREATE INDEX idx_clicks_url_id ON clicks(url_id);
+CREATE INDEX idx_clicks_clicked_at ON clicks(clicked_at);
@@ -0,0 +1,16 @@
+DROP TABLE visitor_salts;
+DROP TABLE url_revisions;
+
+ALTER TABLE clicks DROP COLUMN is_bot;
+ALTER TABLE clicks DROP COLUMN visitor_hash;
+
+ALTER TABLE urls DROP COLUMN redirect_chain;
+ALTER TABLE urls DROP COLUMN api_key_id;
+ALTER TABLE urls DROP COLUMN disabled;
+ALTER TABLE urls DROP COLUMN password_hash;
+ALTER TABLE urls DROP COLUMN max_clicks;
+ALTER TABLE urls DROP COLUMN expires_at;
+ALTER TABLE urls DROP COLUMN is_alias;
+ALTER TABLE urls DROP COLUMN bot_clicks;
+
+DROP TABLE api_keys;
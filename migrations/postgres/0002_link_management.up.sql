@@ -0,0 +1,37 @@
+-- Aliases, expiry, click limits, passwords, disabling, edit history, API keys,
+-- shortener chains, bot and unique visitor tracking
+CREATE TABLE api_keys (
+	id BIGSERIAL PRIMARY KEY,
+	name TEXT NOT NULL UNIQUE,
+	key_hash TEXT NOT NULL UNIQUE,
+	created_at TIMESTAMP(0) NOT NULL DEFAULT (now() AT TIME ZONE 'UTC'),
+	revoked_at TIMESTAMP(0)
+);
+
+ALTER TABLE urls ADD COLUMN bot_clicks BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE urls ADD COLUMN is_alias BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE urls ADD COLUMN expires_at TIMESTAMP(0);
+ALTER TABLE urls ADD COLUMN max_clicks BIGINT;
+ALTER TABLE urls ADD COLUMN password_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE urls ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE urls ADD COLUMN api_key_id BIGINT REFERENCES api_keys(id);
+ALTER TABLE urls ADD COLUMN redirect_chain TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE clicks ADD COLUMN visitor_hash TEXT;
+ALTER TABLE clicks ADD COLUMN is_bot BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE url_revisions (
+	id BIGSERIAL PRIMARY KEY,
+	url_id BIGINT NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+	previous_url TEXT NOT NULL,
+	new_url TEXT NOT NULL,
+	changed_at TIMESTAMP(0) NOT NULL DEFAULT (now() AT TIME ZONE 'UTC'),
+	actor TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX idx_url_revisions_url_id ON url_revisions(url_id);
+
+CREATE TABLE visitor_salts (
+	day TEXT PRIMARY KEY,
+	salt TEXT NOT NULL
+);
@@ -0,0 +1,6 @@
+-- Plain links that new requests for the same destination share are marked with
+-- a unique reuse key, so that concurrent requests can't create duplicates.
+-- Existing links are given their normalized key by the migration's Go step.
+ALTER TABLE urls ADD COLUMN reuse_key TEXT;
+
+CREATE UNIQUE INDEX idx_urls_reuse_key ON urls(reuse_key);
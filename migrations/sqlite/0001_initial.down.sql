@@ -0,0 +1,2 @@
+DROP TABLE clicks;
+DROP TABLE urls;
@@ -0,0 +1,27 @@
+DROP TABLE visitor_salts;
+DROP TABLE url_revisions;
+
+ALTER TABLE clicks DROP COLUMN is_bot;
+ALTER TABLE clicks DROP COLUMN visitor_hash;
+
+-- api_key_id can't be dropped while it references api_keys, so rebuild the table
+CREATE TABLE urls_previous (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	short_code TEXT NOT NULL UNIQUE,
+	original_url TEXT NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	clicks INTEGER DEFAULT 0,
+	last_clicked_at DATETIME
+);
+
+INSERT INTO urls_previous (id, short_code, original_url, created_at, clicks, last_clicked_at)
+SELECT id, short_code, original_url, created_at, clicks, last_clicked_at FROM urls;
+
+DROP TABLE urls;
+ALTER TABLE urls_previous RENAME TO urls;
+
+CREATE INDEX idx_short_code ON urls(short_code);
+CREATE INDEX idx_original_url ON urls(original_url);
+CREATE INDEX idx_created_at ON urls(created_at);
+
+DROP TABLE api_keys;
@@ -0,0 +1,38 @@
+-- Aliases, expiry, click limits, passwords, disabling, edit history, API keys,
+-- shortener chains, bot and unique visitor tracking
+CREATE TABLE api_keys (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE,
+	key_hash TEXT NOT NULL UNIQUE,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	revoked_at DATETIME
+);
+
+ALTER TABLE urls ADD COLUMN bot_clicks INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE urls ADD COLUMN is_alias BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE urls ADD COLUMN expires_at DATETIME;
+ALTER TABLE urls ADD COLUMN max_clicks INTEGER;
+ALTER TABLE urls ADD COLUMN password_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE urls ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE urls ADD COLUMN api_key_id INTEGER REFERENCES api_keys(id);
+ALTER TABLE urls ADD COLUMN redirect_chain TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE clicks ADD COLUMN visitor_hash TEXT;
+ALTER TABLE clicks ADD COLUMN is_bot BOOLEAN NOT NULL DEFAULT 0;
+
+CREATE TABLE url_revisions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	url_id INTEGER NOT NULL,
+	previous_url TEXT NOT NULL,
+	new_url TEXT NOT NULL,
+	changed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	actor TEXT NOT NULL DEFAULT '',
+	FOREIGN KEY (url_id) REFERENCES urls(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_url_revisions_url_id ON url_revisions(url_id);
+
+CREATE TABLE visitor_salts (
+	day TEXT PRIMARY KEY,
+	salt TEXT NOT NULL
+);
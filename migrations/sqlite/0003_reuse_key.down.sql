@@ -0,0 +1,2 @@
+DROP INDEX idx_urls_reuse_key;
+ALTER TABLE urls DROP COLUMN reuse_key;
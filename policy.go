@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Policy error codes returned to API clients
+const (
+	PolicyDomainBlocked    = "domain_blocked"
+	PolicyURLBlocked       = "url_blocked"
+	PolicyDomainNotAllowed = "domain_not_allowed"
+)
+
+// URLPolicy decides whether a destination may be shortened or followed
+type URLPolicy interface {
+	Check(u *url.URL) error
+}
+
+// PolicyError is returned when a URL is rejected by a URLPolicy
+type PolicyError struct {
+	Code   string
+	Reason string
+}
+
+func (e *PolicyError) Error() string {
+	return e.Reason
+}
+
+// PolicyFile is the JSON format of the file loaded from Config.PolicyFile.
+// Domains match themselves and all of their subdomains; patterns are regular
+// expressions matched against the full URL. An empty AllowDomains allows all.
+type PolicyFile struct {
+	BlockDomains  []string `json:"block_domains"`
+	BlockPatterns []string `json:"block_patterns"`
+	AllowDomains  []string `json:"allow_domains"`
+}
+
+// policyRules is a compiled PolicyFile
+type policyRules struct {
+	blockDomains  []string
+	blockPatterns []*regexp.Regexp
+	allowDomains  []string
+}
+
+// compile validates and normalises a PolicyFile
+func (f *PolicyFile) compile() (*policyRules, error) {
+	rules := &policyRules{
+		blockDomains: normalizeDomains(f.BlockDomains),
+		allowDomains: normalizeDomains(f.AllowDomains),
+	}
+
+	for _, pattern := range f.BlockPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid block pattern %q: %w", pattern, err)
+		}
+		rules.blockPatterns = append(rules.blockPatterns, re)
+	}
+
+	return rules, nil
+}
+
+// normalizeDomains lowercases domains and strips leading and trailing dots
+func normalizeDomains(domains []string) []string {
+	var normalized []string
+	for _, domain := range domains {
+		domain = strings.Trim(strings.ToLower(strings.TrimSpace(domain)), ".")
+		if domain != "" {
+			normalized = append(normalized, domain)
+		}
+	}
+	return normalized
+}
+
+// matchDomain reports whether host is one of domains or a subdomain of one
+func matchDomain(host string, domains []string) bool {
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check applies the rules to u
+func (r *policyRules) Check(u *url.URL) error {
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+
+	if len(r.allowDomains) > 0 && !matchDomain(host, r.allowDomains) {
+		return &PolicyError{Code: PolicyDomainNotAllowed, Reason: fmt.Sprintf("domain %q is not allowed", host)}
+	}
+
+	if matchDomain(host, r.blockDomains) {
+		return &PolicyError{Code: PolicyDomainBlocked, Reason: fmt.Sprintf("domain %q is blocked", host)}
+	}
+
+	for _, re := range r.blockPatterns {
+		if re.MatchString(u.String()) {
+			return &PolicyError{Code: PolicyURLBlocked, Reason: "URL is blocked"}
+		}
+	}
+
+	return nil
+}
+
+// filePolicy is a URLPolicy loaded from a PolicyFile that is reloaded when it changes
+type filePolicy struct {
+	path string
+
+	mu      sync.RWMutex
+	rules   *policyRules
+	modTime time.Time
+}
+
+// newFilePolicy loads the policy at path
+func newFilePolicy(path string) (*filePolicy, error) {
+	p := &filePolicy{path: path}
+	if _, err := p.reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// reload re-reads the policy file if it changed since the last load.
+// It reports whether new rules were loaded; on error the old rules are kept.
+func (p *filePolicy) reload() (bool, error) {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat policy file: %w", err)
+	}
+
+	p.mu.RLock()
+	unchanged := p.rules != nil && info.ModTime().Equal(p.modTime)
+	p.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	var file PolicyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return false, fmt.Errorf("failed to parse policy file: %w", err)
+	}
+
+	rules, err := file.compile()
+	if err != nil {
+		return false, err
+	}
+
+	p.mu.Lock()
+	p.rules = rules
+	p.modTime = info.ModTime()
+	p.mu.Unlock()
+
+	return true, nil
+}
+
+// watch polls the policy file for changes until ctx is cancelled
+func (p *filePolicy) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := p.reload()
+			if err != nil {
+				log.Error("Failed to reload URL policy, keeping previous rules", "path", p.path, "error", err)
+			} else if reloaded {
+				log.Info("URL policy reloaded", "path", p.path)
+			}
+		}
+	}
+}
+
+// Check applies the currently loaded rules to u
+func (p *filePolicy) Check(u *url.URL) error {
+	p.mu.RLock()
+	rules := p.rules
+	p.mu.RUnlock()
+
+	return rules.Check(u)
+}
+
+// WithPolicy replaces the URL policy loaded from Config.PolicyFile
+func WithPolicy(policy URLPolicy) AppOption {
+	return func(a *App) error {
+		if policy == nil {
+			return fmt.Errorf("policy cannot be nil")
+		}
+		a.policy = policy
+		return nil
+	}
+}
+
+// checkPolicy validates rawURL against the configured policy, if any
+func (a *App) checkPolicy(rawURL string) error {
+	if a.policy == nil {
+		return nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL format: %w", err)
+	}
+
+	return a.policy.Check(u)
+}
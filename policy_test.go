@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPolicyRules_Check(t *testing.T) {
+	file := &PolicyFile{
+		BlockDomains:  []string{"Evil.example", "phish.test."},
+		BlockPatterns: []string{`(?i)/wp-login\.php`},
+	}
+
+	rules, err := file.compile()
+	if err != nil {
+		t.Fatalf("Failed to compile policy: %v", err)
+	}
+
+	testCases := []struct {
+		url      string
+		expected string
+		name     string
+	}{
+		{"https://www.example.com/", "", "allowed"},
+		{"https://evil.example/login", PolicyDomainBlocked, "blocked domain"},
+		{"https://login.EVIL.example./", PolicyDomainBlocked, "blocked subdomain"},
+		{"https://notevil.example/", "", "suffix without dot"},
+		{"http://phish.test:8080/", PolicyDomainBlocked, "blocked domain with port"},
+		{"https://blog.example.com/WP-LOGIN.php", PolicyURLBlocked, "blocked pattern"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			u, _ := url.Parse(tc.url)
+			err := rules.Check(u)
+
+			var policyErr *PolicyError
+			switch {
+			case tc.expected == "" && err != nil:
+				t.Errorf("Expected '%s' to be allowed, got: %v", tc.url, err)
+			case tc.expected != "" && (!errors.As(err, &policyErr) || policyErr.Code != tc.expected):
+				t.Errorf("Expected '%s' to be rejected with %s, got: %v", tc.url, tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestPolicyRules_AllowDomains(t *testing.T) {
+	rules, err := (&PolicyFile{AllowDomains: []string{"example.com"}}).compile()
+	if err != nil {
+		t.Fatalf("Failed to compile policy: %v", err)
+	}
+
+	allowed, _ := url.Parse("https://docs.example.com/")
+	if err := rules.Check(allowed); err != nil {
+		t.Errorf("Expected allowlisted subdomain to pass, got: %v", err)
+	}
+
+	other, _ := url.Parse("https://example.org/")
+	var policyErr *PolicyError
+	if err := rules.Check(other); !errors.As(err, &policyErr) || policyErr.Code != PolicyDomainNotAllowed {
+		t.Errorf("Expected %s, got: %v", PolicyDomainNotAllowed, err)
+	}
+}
+
+func TestPolicyFile_InvalidPattern(t *testing.T) {
+	if _, err := (&PolicyFile{BlockPatterns: []string{"("}}).compile(); err == nil {
+		t.Error("Expected error for invalid pattern, got nil")
+	}
+}
+
+func TestFilePolicy_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	writePolicy := func(content string, modTime time.Time) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write policy file: %v", err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("Failed to set policy file time: %v", err)
+		}
+	}
+
+	start := time.Now().Add(-time.Hour)
+	writePolicy(`{"block_domains":["evil.example"]}`, start)
+
+	policy, err := newFilePolicy(path)
+	if err != nil {
+		t.Fatalf("Failed to load policy: %v", err)
+	}
+
+	target, _ := url.Parse("https://newly-bad.example/")
+	if err := policy.Check(target); err != nil {
+		t.Fatalf("Expected URL to be allowed before reload, got: %v", err)
+	}
+
+	writePolicy(`{"block_domains":["evil.example","newly-bad.example"]}`, start.Add(time.Minute))
+	if reloaded, err := policy.reload(); !reloaded || err != nil {
+		t.Fatalf("Expected policy to reload, got reloaded=%v err=%v", reloaded, err)
+	}
+
+	if err := policy.Check(target); err == nil {
+		t.Error("Expected URL to be blocked after reload")
+	}
+
+	// A broken file keeps the previous rules
+	writePolicy(`{not json`, start.Add(2*time.Minute))
+	if _, err := policy.reload(); err == nil {
+		t.Error("Expected error for invalid policy file")
+	}
+
+	if err := policy.Check(target); err == nil {
+		t.Error("Expected previous rules to stay active")
+	}
+}
+
+func TestPolicy_ShortenAndRedirect(t *testing.T) {
+	rules, err := (&PolicyFile{BlockDomains: []string{"evil.example"}}).compile()
+	if err != nil {
+		t.Fatalf("Failed to compile policy: %v", err)
+	}
+
+	cfg := &Config{
+		DatabaseURL: "file::memory:?cache=shared",
+		Port:        "7000",
+		BaseURL:     "http://localhost:7000",
+	}
+
+	app, err := NewApp(context.Background(), cfg, WithPolicy(rules), WithResolver(publicResolver{}))
+	if err != nil {
+		t.Fatalf("Failed to create app: %v", err)
+	}
+	defer app.store.Close()
+
+	req := httptest.NewRequest("POST", "/s", strings.NewReader(`{"url":"https://evil.example/login"}`))
+	rec := httptest.NewRecorder()
+	app.handleShorten(rec, req)
+
+	var errResp ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&errResp); err != nil {
+		t.Fatalf("Failed to decode error response: %v", err)
+	}
+
+	if rec.Code != http.StatusForbidden || errResp.Code != PolicyDomainBlocked {
+		t.Errorf("Expected status %d with code %s, got %d with '%s'", http.StatusForbidden, PolicyDomainBlocked, rec.Code, errResp.Code)
+	}
+
+	// Links created before a domain was blocked stop redirecting
+	_, err = testDB(app).Exec("INSERT INTO urls (short_code, original_url) VALUES (?, ?)", "legacy-link", "https://sub.evil.example/")
+	if err != nil {
+		t.Fatalf("Failed to insert URL: %v", err)
+	}
+
+	redirectRec := httptest.NewRecorder()
+	app.handleRedirect(redirectRec, httptest.NewRequest("GET", "/legacy-link", nil))
+
+	if redirectRec.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, redirectRec.Code)
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rate limit budgets, each configured in requests per minute
+const (
+	budgetShorten  = "shorten"
+	budgetRedirect = "redirect"
+	budgetQR       = "qr"
+	budgetUnlock   = "unlock"
+)
+
+// rateLimitBudgets maps routes from setupRoutes to the budget they draw from.
+// Routes that aren't listed are not rate limited.
+var rateLimitBudgets = map[string]string{
+	"POST /s":                   budgetShorten,
+	"GET /s":                    budgetShorten,
+	"PATCH /{shortCode}":        budgetShorten,
+	"DELETE /{shortCode}":       budgetShorten,
+	"POST /{shortCode}/disable": budgetShorten,
+	"POST /{shortCode}/enable":  budgetShorten,
+	"GET /{shortCode}":          budgetRedirect,
+	"POST /{shortCode}":         budgetUnlock,
+	"GET /{shortCode}/qr":       budgetQR,
+}
+
+// bucket is a single client's token bucket
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter is a token bucket limiter holding one bucket per client
+type rateLimiter struct {
+	mu        sync.Mutex
+	limit     int
+	rate      float64 // tokens per second
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// newRateLimiter creates a limiter allowing perMinute requests per client,
+// with bursts of up to perMinute. It returns nil if perMinute is not positive.
+func newRateLimiter(perMinute int) *rateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+
+	return &rateLimiter{
+		limit:   perMinute,
+		rate:    float64(perMinute) / 60,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// allow takes a token from key's bucket. It returns whether the request is
+// allowed, the tokens left, and how long until the next token is available.
+// A nil limiter allows everything.
+func (l *rateLimiter) allow(key string, now time.Time) (bool, int, time.Duration) {
+	if l == nil {
+		return true, 0, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.limit), last: now}
+		l.buckets[key] = b
+	}
+
+	// Refill for the time elapsed since the last request
+	b.tokens = math.Min(float64(l.limit), b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, 0, wait
+	}
+
+	b.tokens--
+	return true, int(b.tokens), 0
+}
+
+// wait returns how long until key's bucket has a token, without taking one.
+// A nil limiter never waits.
+func (l *rateLimiter) wait(key string, now time.Time) time.Duration {
+	if l == nil {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		return 0
+	}
+
+	tokens := math.Min(float64(l.limit), b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	if tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - tokens) / l.rate * float64(time.Second))
+}
+
+// resetAfter returns how long until key's bucket is full again
+func (l *rateLimiter) resetAfter(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		return 0
+	}
+	return time.Duration((float64(l.limit) - b.tokens) / l.rate * float64(time.Second))
+}
+
+// sweep drops buckets that have refilled completely, at most once a minute
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+
+	full := time.Duration(float64(l.limit) / l.rate * float64(time.Second))
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// parseNetworks parses a list of IPs and CIDR ranges, such as the proxies
+// allowed to set X-Forwarded-For
+func parseNetworks(entries []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid network %q", entry)
+			}
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q: %w", entry, err)
+		}
+		nets = append(nets, ipNet)
+	}
+
+	return nets, nil
+}
+
+// isTrustedProxy reports whether ip belongs to one of the trusted proxy ranges
+func isTrustedProxy(ip net.IP, trusted []*net.IPNet) bool {
+	for _, ipNet := range trusted {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the client that sent r. X-Forwarded-For is
+// only honoured when the direct peer is a trusted proxy, and is walked from the
+// right so that clients can't spoof their address by prepending entries.
+func clientIP(r *http.Request, trusted []*net.IPNet) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !isTrustedProxy(ip, trusted) {
+		return host
+	}
+
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		host = hop.String()
+		if !isTrustedProxy(hop, trusted) {
+			break
+		}
+	}
+
+	return host
+}
+
+// rateLimitMiddleware applies the per-route budgets from Config to requests,
+// keyed by API key when the request is authenticated and by client IP otherwise.
+// Password unlocks are always keyed by client IP and short code.
+// It sets RateLimit-* headers on limited routes and Retry-After on 429 responses.
+func (a *App) rateLimitMiddleware(mux *http.ServeMux) http.Handler {
+	limiters := map[string]*rateLimiter{
+		budgetShorten:  newRateLimiter(a.config.RateLimitShorten),
+		budgetRedirect: newRateLimiter(a.config.RateLimitRedirect),
+		budgetQR:       newRateLimiter(a.config.RateLimitQR),
+		budgetUnlock:   newRateLimiter(a.config.RateLimitUnlock),
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+		budget := rateLimitBudgets[pattern]
+		limiter := limiters[budget]
+		if limiter == nil {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		key := "ip:" + clientIP(r, a.trustedProxies)
+		if budget == budgetUnlock {
+			// Password guesses are limited per link, whatever key the client holds
+			key += " code:" + strings.Trim(r.URL.Path, "/")
+		} else if apiKey := apiKeyFromContext(r.Context()); apiKey != nil {
+			key = "key:" + strconv.FormatInt(apiKey.ID, 10)
+		}
+
+		allowed, remaining, wait := limiter.allow(key, time.Now())
+
+		w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=60", limiter.limit))
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(limiter.limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil(limiter.resetAfter(key).Seconds()))))
+
+		if !allowed {
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			loggerFromContext(r.Context()).Warn("Rate limit exceeded", "budget", budget, "client", key, "path", r.URL.Path, "retry_after", retryAfter)
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			writeError(w, http.StatusTooManyRequests, "Rate limit exceeded")
+			return
+		}
+
+		mux.ServeHTTP(w, r)
+	})
+}
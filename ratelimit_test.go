@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Allow(t *testing.T) {
+	limiter := newRateLimiter(60) // one token per second
+	now := time.Now()
+
+	for i := 0; i < 60; i++ {
+		if ok, _, _ := limiter.allow("client", now); !ok {
+			t.Fatalf("Expected request %d to be allowed", i+1)
+		}
+	}
+
+	ok, remaining, wait := limiter.allow("client", now)
+	if ok || remaining != 0 {
+		t.Errorf("Expected burst to be exhausted, got ok=%v remaining=%d", ok, remaining)
+	}
+
+	if wait <= 0 || wait > time.Second {
+		t.Errorf("Expected wait of up to a second, got %v", wait)
+	}
+
+	// Other clients have their own bucket
+	if ok, _, _ := limiter.allow("other", now); !ok {
+		t.Error("Expected other client to be allowed")
+	}
+
+	// Tokens refill over time
+	if ok, _, _ := limiter.allow("client", now.Add(time.Second)); !ok {
+		t.Error("Expected request to be allowed after refill")
+	}
+}
+
+func TestNewRateLimiter_Disabled(t *testing.T) {
+	if newRateLimiter(0) != nil {
+		t.Error("Expected nil limiter for zero budget")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted, err := parseNetworks([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatalf("Failed to parse trusted proxies: %v", err)
+	}
+
+	testCases := []struct {
+		remoteAddr string
+		forwarded  string
+		expected   string
+		name       string
+	}{
+		{"203.0.113.5:1234", "", "203.0.113.5", "direct client"},
+		{"203.0.113.5:1234", "198.51.100.7", "203.0.113.5", "untrusted peer ignores header"},
+		{"10.1.2.3:1234", "198.51.100.7", "198.51.100.7", "trusted proxy"},
+		{"10.1.2.3:1234", "1.2.3.4, 198.51.100.7, 192.168.1.1", "198.51.100.7", "spoofed prefix and proxy chain"},
+		{"10.1.2.3:1234", "", "10.1.2.3", "trusted proxy without header"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tc.remoteAddr
+			if tc.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tc.forwarded)
+			}
+
+			if ip := clientIP(req, trusted); ip != tc.expected {
+				t.Errorf("Expected client IP '%s', got '%s'", tc.expected, ip)
+			}
+		})
+	}
+}
+
+func TestParseNetworks_Invalid(t *testing.T) {
+	for _, entry := range []string{"not-an-ip", "10.0.0.0/33"} {
+		if _, err := parseNetworks([]string{entry}); err == nil {
+			t.Errorf("Expected error for '%s', got nil", entry)
+		}
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	app.config.RateLimitShorten = 2
+	handler := app.rateLimitMiddleware(app.setupRoutes())
+
+	shorten := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/s?u=https://www.example.com/limited", nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := 0; i < 2; i++ {
+		rec := shorten()
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Request %d: expected status %d, got %d", i+1, http.StatusCreated, rec.Code)
+		}
+		if rec.Header().Get("RateLimit-Limit") != "2" {
+			t.Errorf("Expected RateLimit-Limit 2, got '%s'", rec.Header().Get("RateLimit-Limit"))
+		}
+	}
+
+	rec := shorten()
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status %d, got %d", http.StatusTooManyRequests, rec.Code)
+	}
+
+	if rec.Header().Get("Retry-After") == "" || rec.Header().Get("RateLimit-Remaining") != "0" {
+		t.Error("Expected Retry-After and RateLimit-Remaining headers on 429")
+	}
+
+	// Redirects draw from a separate, unlimited budget here
+	redirectRec := httptest.NewRecorder()
+	handler.ServeHTTP(redirectRec, httptest.NewRequest("GET", "/nonexistent", nil))
+
+	if redirectRec.Code != http.StatusNotFound || redirectRec.Header().Get("RateLimit-Limit") != "" {
+		t.Errorf("Expected unlimited redirect, got status %d", redirectRec.Code)
+	}
+
+	// Unlisted routes are never limited
+	for i := 0; i < 3; i++ {
+		healthRec := httptest.NewRecorder()
+		handler.ServeHTTP(healthRec, httptest.NewRequest("GET", "/health", nil))
+		if healthRec.Code != http.StatusOK {
+			t.Errorf("Expected health check to be unlimited, got status %d", healthRec.Code)
+		}
+	}
+}
+
+func TestRateLimitMiddleware_KeyedByAPIKey(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	key, err := app.createAPIKey(context.Background(), "ci")
+	if err != nil {
+		t.Fatalf("Failed to create API key: %v", err)
+	}
+
+	app.config.RateLimitShorten = 1
+	mux := app.setupRoutes()
+	handler := app.authMiddleware(mux, app.rateLimitMiddleware(mux))
+
+	shorten := func(authorization string) int {
+		req := httptest.NewRequest("POST", "/s", strings.NewReader(`{"url":"https://www.example.com/keyed"}`))
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := shorten(""); code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", http.StatusCreated, code)
+	}
+
+	// Same IP, but the API key has its own budget
+	if code := shorten("Bearer " + key); code != http.StatusCreated {
+		t.Errorf("Expected status %d with API key, got %d", http.StatusCreated, code)
+	}
+
+	if code := shorten(""); code != http.StatusTooManyRequests {
+		t.Errorf("Expected status %d without API key, got %d", http.StatusTooManyRequests, code)
+	}
+}
+
+func TestRateLimitMiddleware_Unlock(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	app.config.RateLimitUnlock = 5
+	handler := app.rateLimitMiddleware(app.setupRoutes())
+
+	var codes []string
+	for _, url := range []string{"https://www.example.com/locked", "https://www.example.com/also-locked"} {
+		resp, err := app.createShortURL(context.Background(), &ShortenRequest{URL: url, Password: "hunter2"})
+		if err != nil {
+			t.Fatalf("Failed to create short URL: %v", err)
+		}
+		codes = append(codes, resp.ShortCode)
+	}
+
+	unlock := func(shortCode string) int {
+		req := httptest.NewRequest("POST", "/"+shortCode, strings.NewReader("password=wrong"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	for i := 0; i < 5; i++ {
+		if code := unlock(codes[0]); code != http.StatusUnauthorized {
+			t.Fatalf("Attempt %d: expected status %d, got %d", i+1, http.StatusUnauthorized, code)
+		}
+	}
+
+	if code := unlock(codes[0]); code != http.StatusTooManyRequests {
+		t.Errorf("Expected status %d on sixth attempt, got %d", http.StatusTooManyRequests, code)
+	}
+
+	// Each link has its own budget, separate from redirects
+	if code := unlock(codes[1]); code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for another link, got %d", http.StatusUnauthorized, code)
+	}
+
+	redirectRec := httptest.NewRecorder()
+	handler.ServeHTTP(redirectRec, httptest.NewRequest("GET", "/"+codes[0], nil))
+
+	if redirectRec.Code != http.StatusOK {
+		t.Errorf("Expected unlock form, got status %d", redirectRec.Code)
+	}
+}
+
+func TestAuthMiddleware_InvalidKeysLimited(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	key, err := app.createAPIKey(context.Background(), "ci")
+	if err != nil {
+		t.Fatalf("Failed to create API key: %v", err)
+	}
+
+	app.authFailures = newRateLimiter(3)
+	mux := app.setupRoutes()
+	handler := app.authMiddleware(mux, app.rateLimitMiddleware(mux))
+
+	shorten := func(remoteAddr, authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/s", strings.NewReader(`{"url":"https://www.example.com/guessed"}`))
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("Authorization", authorization)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := 0; i < 3; i++ {
+		if rec := shorten("192.0.2.1:1234", "Bearer ul_wrong"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("Attempt %d: expected status %d, got %d", i+1, http.StatusUnauthorized, rec.Code)
+		}
+	}
+
+	// Once the budget is used up, even a valid key is refused before the lookup
+	rec := shorten("192.0.2.1:1234", "Bearer "+key)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status %d, got %d", http.StatusTooManyRequests, rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("Expected Retry-After header on 429")
+	}
+
+	// Other clients are unaffected
+	if rec := shorten("192.0.2.2:1234", "Bearer "+key); rec.Code != http.StatusCreated {
+		t.Errorf("Expected status %d for another client, got %d", http.StatusCreated, rec.Code)
+	}
+}
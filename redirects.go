@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Policy error codes for destinations that redirect back to us or never settle
+const (
+	PolicyRedirectLoop     = "redirect_loop"
+	PolicyTooManyRedirects = "too_many_redirects"
+	PolicyRedirectTimeout  = "redirect_timeout"
+)
+
+// redirectRequestTimeout bounds each request made while following a shortener
+const redirectRequestTimeout = 5 * time.Second
+
+// redirectChainTimeout bounds following a whole chain of shorteners, which
+// could otherwise take maxHops times redirectRequestTimeout
+const redirectChainTimeout = 10 * time.Second
+
+// chainResolver follows links on known URL shortener hosts to their final
+// destination, recording each URL along the way
+type chainResolver struct {
+	client  *http.Client
+	hosts   []string
+	maxHops int
+	timeout time.Duration
+}
+
+// newChainResolver creates a resolver following up to maxHops redirects on hosts.
+// Redirects are followed one at a time, so client must not follow them itself.
+func newChainResolver(client *http.Client, hosts []string, maxHops int) *chainResolver {
+	noFollow := *client
+	noFollow.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	return &chainResolver{
+		client:  &noFollow,
+		hosts:   normalizeDomains(hosts),
+		maxHops: maxHops,
+		timeout: redirectChainTimeout,
+	}
+}
+
+// isShortener reports whether u is hosted by a known URL shortener
+func (c *chainResolver) isShortener(u *url.URL) bool {
+	return matchDomain(strings.TrimSuffix(strings.ToLower(u.Hostname()), "."), c.hosts)
+}
+
+// next requests a shortener link and returns where it redirects to, or "" if it doesn't
+func (c *chainResolver) next(ctx context.Context, u *url.URL) (string, error) {
+	var resp *http.Response
+	var err error
+
+	// Not every shortener answers HEAD, so fall back to GET
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		var req *http.Request
+		req, err = http.NewRequestWithContext(ctx, method, u.String(), nil)
+		if err != nil {
+			return "", err
+		}
+
+		resp, err = c.client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusMethodNotAllowed && resp.StatusCode != http.StatusNotImplemented {
+			break
+		}
+	}
+
+	location := resp.Header.Get("Location")
+	if resp.StatusCode < 300 || resp.StatusCode >= 400 || location == "" {
+		return "", nil
+	}
+
+	target, err := u.Parse(location)
+	if err != nil {
+		return "", fmt.Errorf("invalid redirect location %q: %w", location, err)
+	}
+
+	return target.String(), nil
+}
+
+// Resolve follows rawURL while it points at a known shortener. It returns the
+// final destination and the URLs that led to it, starting with rawURL; the
+// chain is empty when rawURL isn't a shortener link. A shortener that can't be
+// reached ends the chain early rather than failing the request, but a chain
+// that takes longer than c.timeout to follow is rejected.
+func (c *chainResolver) Resolve(ctx context.Context, rawURL string, isSelf func(*url.URL) bool) (string, []string, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	var chain []string
+	current := rawURL
+
+	for {
+		u, err := url.Parse(current)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid URL format: %w", err)
+		}
+
+		if isSelf(u) {
+			return "", nil, selfLoopError(current)
+		}
+
+		if !c.isShortener(u) {
+			return current, chain, nil
+		}
+
+		if len(chain) >= c.maxHops {
+			return "", nil, &PolicyError{
+				Code:   PolicyTooManyRedirects,
+				Reason: fmt.Sprintf("URL redirects through more than %d shorteners", c.maxHops),
+			}
+		}
+
+		next, err := c.next(ctx, u)
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return "", nil, &PolicyError{
+				Code:   PolicyRedirectTimeout,
+				Reason: fmt.Sprintf("URL %q took longer than %s to follow", rawURL, c.timeout),
+			}
+		}
+		if err != nil {
+			loggerFromContext(ctx).Warn("Failed to follow shortener link", "url", current, "error", err)
+			return current, chain, nil
+		}
+		if next == "" {
+			return current, chain, nil
+		}
+
+		if err := validateURL(next); err != nil {
+			return "", nil, fmt.Errorf("shortener at %q redirects to an invalid URL: %w", current, err)
+		}
+
+		chain = append(chain, current)
+		if slices.Contains(chain, next) {
+			return "", nil, &PolicyError{
+				Code:   PolicyRedirectLoop,
+				Reason: fmt.Sprintf("URL %q redirects in a loop", rawURL),
+			}
+		}
+		current = next
+	}
+}
+
+func selfLoopError(rawURL string) error {
+	return &PolicyError{
+		Code:   PolicyRedirectLoop,
+		Reason: fmt.Sprintf("URL %q points back at this shortener", rawURL),
+	}
+}
+
+// WithHTTPClient sets the client used to follow links on known shorteners
+func WithHTTPClient(client *http.Client) AppOption {
+	return func(a *App) error {
+		if client == nil {
+			return fmt.Errorf("http client cannot be nil")
+		}
+		if a.config.ResolveShorteners {
+			a.chains = newChainResolver(client, a.config.ShortenerHosts, a.config.MaxRedirectHops)
+		}
+		return nil
+	}
+}
+
+// isSelf reports whether u is hosted by this shortener, per Config.BaseURL
+func (a *App) isSelf(u *url.URL) bool {
+	base, err := url.Parse(a.config.BaseURL)
+	if err != nil || base.Hostname() == "" {
+		return false
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	return host == strings.TrimSuffix(strings.ToLower(base.Hostname()), ".")
+}
+
+// resolveDestination rejects URLs that point back at this shortener and, when
+// Config.ResolveShorteners is set, follows known shorteners to the final
+// destination. It returns the destination to store and the chain leading to it.
+func (a *App) resolveDestination(ctx context.Context, rawURL string) (string, []string, error) {
+	if a.chains != nil {
+		return a.chains.Resolve(ctx, rawURL, a.isSelf)
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid URL format: %w", err)
+	}
+	if a.isSelf(u) {
+		return "", nil, selfLoopError(rawURL)
+	}
+
+	return rawURL, nil, nil
+}
+
+// encodeChain converts a redirect chain to its stored JSON form, "" if empty
+func encodeChain(chain []string) string {
+	if len(chain) == 0 {
+		return ""
+	}
+
+	// Marshalling a []string can't fail
+	data, _ := json.Marshal(chain)
+	return string(data)
+}
+
+// decodeChain parses a redirect chain stored by encodeChain
+func decodeChain(stored string) ([]string, error) {
+	if stored == "" {
+		return nil, nil
+	}
+
+	var chain []string
+	if err := json.Unmarshal([]byte(stored), &chain); err != nil {
+		return nil, fmt.Errorf("invalid redirect chain: %w", err)
+	}
+	return chain, nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// redirectTransport answers requests with redirects from a fixed table,
+// and 200 OK for anything else
+type redirectTransport map[string]string
+
+func (t redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp := &http.Response{StatusCode: http.StatusOK, Header: make(http.Header), Body: http.NoBody, Request: req}
+	if location, ok := t[req.URL.String()]; ok {
+		resp.StatusCode = http.StatusMovedPermanently
+		resp.Header.Set("Location", location)
+	}
+	return resp, nil
+}
+
+// hangingTransport never answers, until the request is cancelled
+type hangingTransport struct{}
+
+func (hangingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	<-req.Context().Done()
+	return nil, req.Context().Err()
+}
+
+func setupChainTestApp(t *testing.T, redirects redirectTransport) *App {
+	t.Helper()
+
+	cfg := &Config{
+		DatabaseURL:       "file::memory:?cache=shared",
+		Port:              "7000",
+		BaseURL:           "https://ul.example",
+		ResolveShorteners: true,
+		ShortenerHosts:    []string{"bit.ly", "tinyurl.com"},
+		MaxRedirectHops:   3,
+	}
+
+	app, err := NewApp(context.Background(), cfg, WithHTTPClient(&http.Client{Transport: redirects}), WithResolver(publicResolver{}))
+	if err != nil {
+		t.Fatalf("Failed to create app: %v", err)
+	}
+
+	return app
+}
+
+func TestCreateShortURL_SelfLoop(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+	app.config.BaseURL = "https://ul.example"
+
+	_, err := app.createShortURL(context.Background(), &ShortenRequest{URL: "https://UL.example./abc123"})
+
+	var policyErr *PolicyError
+	if !errors.As(err, &policyErr) || policyErr.Code != PolicyRedirectLoop {
+		t.Errorf("Expected %s error, got: %v", PolicyRedirectLoop, err)
+	}
+}
+
+func TestCreateShortURL_ResolvesShortenerChain(t *testing.T) {
+	app := setupChainTestApp(t, redirectTransport{
+		"https://bit.ly/abc":        "https://tinyurl.com/xyz",
+		"https://tinyurl.com/xyz":   "https://example.com/final",
+		"https://example.com/final": "https://example.com/elsewhere",
+	})
+	defer app.store.Close()
+
+	resp, err := app.createShortURL(context.Background(), &ShortenRequest{URL: "https://bit.ly/abc"})
+	if err != nil {
+		t.Fatalf("Failed to create short URL: %v", err)
+	}
+
+	// Only shortener hosts are followed
+	if resp.OriginalURL != "https://example.com/final" {
+		t.Errorf("Expected final destination, got '%s'", resp.OriginalURL)
+	}
+
+	stats, err := app.getStats(context.Background(), resp.ShortCode)
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+
+	expected := []string{"https://bit.ly/abc", "https://tinyurl.com/xyz"}
+	if !reflect.DeepEqual(stats.RedirectChain, expected) {
+		t.Errorf("Expected chain %v, got %v", expected, stats.RedirectChain)
+	}
+
+	// A direct link to the same destination is not deduplicated with the chained one
+	direct, err := app.createShortURL(context.Background(), &ShortenRequest{URL: "https://example.com/final"})
+	if err != nil {
+		t.Fatalf("Failed to create short URL: %v", err)
+	}
+	if direct.ShortCode == resp.ShortCode {
+		t.Error("Expected a separate short code for the direct link")
+	}
+}
+
+func TestCreateShortURL_ShortenerChainErrors(t *testing.T) {
+	app := setupChainTestApp(t, redirectTransport{
+		"https://bit.ly/self":       "https://ul.example/abc",
+		"https://bit.ly/loop1":      "https://tinyurl.com/loop2",
+		"https://tinyurl.com/loop2": "https://bit.ly/loop1",
+		"https://bit.ly/1":          "https://bit.ly/2",
+		"https://bit.ly/2":          "https://bit.ly/3",
+		"https://bit.ly/3":          "https://bit.ly/4",
+		"https://bit.ly/4":          "https://example.com/",
+	})
+	defer app.store.Close()
+
+	testCases := []struct {
+		url      string
+		expected string
+		name     string
+	}{
+		{"https://bit.ly/self", PolicyRedirectLoop, "redirects back to us"},
+		{"https://bit.ly/loop1", PolicyRedirectLoop, "loop between shorteners"},
+		{"https://bit.ly/1", PolicyTooManyRedirects, "too many hops"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := app.createShortURL(context.Background(), &ShortenRequest{URL: tc.url})
+
+			var policyErr *PolicyError
+			if !errors.As(err, &policyErr) || policyErr.Code != tc.expected {
+				t.Errorf("Expected %s error for '%s', got: %v", tc.expected, tc.url, err)
+			}
+		})
+	}
+}
+
+func TestCreateShortURL_ShortenerChainTimeout(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	app.chains = newChainResolver(&http.Client{Transport: hangingTransport{}}, []string{"bit.ly"}, 3)
+	app.chains.timeout = 50 * time.Millisecond
+
+	_, err := app.createShortURL(context.Background(), &ShortenRequest{URL: "https://bit.ly/slow"})
+
+	var policyErr *PolicyError
+	if !errors.As(err, &policyErr) || policyErr.Code != PolicyRedirectTimeout {
+		t.Errorf("Expected %s error, got: %v", PolicyRedirectTimeout, err)
+	}
+}
@@ -1,10 +1,16 @@
 package main
 
 import (
-	"database/sql"
+	"context"
+	"errors"
 	"fmt"
 	"net/url"
+	"strings"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/crypto/bcrypt"
 )
 
 const (
@@ -16,8 +22,37 @@ const (
 
 	// XOR mask for obfuscation
 	xorMask = 0x5d2a8f93
+
+	// Upper bound (exclusive) of the values obfuscateID can produce
+	maxGeneratedValue = 0x80000000
+
+	// Length limits for custom aliases
+	aliasMinLength = 3
+	aliasMaxLength = 64
+
+	// Layout used for timestamps written by the application, matching CURRENT_TIMESTAMP
+	dbTimeFormat = "2006-01-02 15:04:05"
 )
 
+// ErrNotFound is returned when a short code does not exist
+var ErrNotFound = errors.New("short code not found")
+
+// ErrAliasConflict is returned when a requested alias is already taken or
+// could be produced by generateShortCode for a future ID
+var ErrAliasConflict = errors.New("alias is not available")
+
+// ErrClickLimitReached is returned by trackClick when a click-limited link is used up
+var ErrClickLimitReached = errors.New("click limit reached")
+
+// reservedAliases lists paths that are handled by other routes
+var reservedAliases = map[string]bool{
+	"health":  true,
+	"livez":   true,
+	"metrics": true,
+	"readyz":  true,
+	"s":       true,
+}
+
 // URLRecord represents a shortened URL entry
 type URLRecord struct {
 	ID            int64      `json:"id"`
@@ -26,28 +61,116 @@ type URLRecord struct {
 	CreatedAt     time.Time  `json:"created_at"`
 	Clicks        int64      `json:"clicks"`
 	LastClickedAt *time.Time `json:"last_clicked_at,omitempty"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	MaxClicks     *int64     `json:"max_clicks,omitempty"`
+	PasswordHash  string     `json:"-"`
+	Disabled      bool       `json:"disabled"`
+	APIKeyID      *int64     `json:"-"`
+}
+
+// IsExpired reports whether the link has passed its expiry time
+func (r *URLRecord) IsExpired(now time.Time) bool {
+	return r.ExpiresAt != nil && !now.Before(*r.ExpiresAt)
+}
+
+// IsExhausted reports whether a click-limited link has used up its clicks
+func (r *URLRecord) IsExhausted() bool {
+	return r.MaxClicks != nil && r.Clicks >= *r.MaxClicks
 }
 
 // ShortenRequest represents the request body for URL shortening
 type ShortenRequest struct {
-	URL string `json:"url"`
+	URL        string     `json:"url"`
+	Alias      string     `json:"alias,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	TTLSeconds int64      `json:"ttl_seconds,omitempty"`
+	MaxClicks  int64      `json:"max_clicks,omitempty"`
+	Password   string     `json:"password,omitempty"`
+
+	// APIKeyID is the key that authenticated the request, if any
+	APIKeyID int64 `json:"-"`
+}
+
+// expiry resolves the requested expiry time, if any, relative to now
+func (req *ShortenRequest) expiry(now time.Time) (*time.Time, error) {
+	if req.ExpiresAt != nil && req.TTLSeconds != 0 {
+		return nil, fmt.Errorf("only one of expires_at and ttl_seconds may be set")
+	}
+
+	var expiresAt time.Time
+	switch {
+	case req.ExpiresAt != nil:
+		expiresAt = *req.ExpiresAt
+	case req.TTLSeconds < 0:
+		return nil, fmt.Errorf("ttl_seconds must be positive")
+	case req.TTLSeconds > 0:
+		expiresAt = now.Add(time.Duration(req.TTLSeconds) * time.Second)
+	default:
+		return nil, nil
+	}
+
+	// Stored with second precision in UTC
+	expiresAt = expiresAt.UTC().Truncate(time.Second)
+	if !expiresAt.After(now) {
+		return nil, fmt.Errorf("expiry must be in the future")
+	}
+
+	return &expiresAt, nil
 }
 
 // ShortenResponse represents the response for URL shortening
 type ShortenResponse struct {
-	ShortCode   string    `json:"short_code"`
-	ShortURL    string    `json:"short_url"`
-	OriginalURL string    `json:"original_url"`
-	CreatedAt   time.Time `json:"created_at"`
+	ShortCode         string     `json:"short_code"`
+	ShortURL          string     `json:"short_url"`
+	OriginalURL       string     `json:"original_url"`
+	CreatedAt         time.Time  `json:"created_at"`
+	ExpiresAt         *time.Time `json:"expires_at,omitempty"`
+	MaxClicks         *int64     `json:"max_clicks,omitempty"`
+	PasswordProtected bool       `json:"password_protected,omitempty"`
 }
 
-// URLStats represents statistics for a shortened URL
+// URLStats represents statistics for a shortened URL. TotalClicks excludes
+// BotClicks unless they are asked for. RedirectChain lists the
+// shortener links that were followed to reach OriginalURL, if any, and
+// UniqueVisitors the distinct visitors on each recent day with clicks.
+// Destinations are left empty for password-protected links.
 type URLStats struct {
-	ShortCode     string     `json:"short_code"`
-	OriginalURL   string     `json:"original_url"`
-	CreatedAt     time.Time  `json:"created_at"`
-	TotalClicks   int64      `json:"total_clicks"`
-	LastClickedAt *time.Time `json:"last_clicked_at,omitempty"`
+	ShortCode         string          `json:"short_code"`
+	OriginalURL       string          `json:"original_url,omitempty"`
+	CreatedAt         time.Time       `json:"created_at"`
+	TotalClicks       int64           `json:"total_clicks"`
+	BotClicks         int64           `json:"bot_clicks"`
+	LastClickedAt     *time.Time      `json:"last_clicked_at,omitempty"`
+	ExpiresAt         *time.Time      `json:"expires_at,omitempty"`
+	MaxClicks         *int64          `json:"max_clicks,omitempty"`
+	PasswordProtected bool            `json:"password_protected,omitempty"`
+	Disabled          bool            `json:"disabled"`
+	RedirectChain     []string        `json:"redirect_chain,omitempty"`
+	UniqueVisitors    []DailyVisitors `json:"unique_visitors"`
+}
+
+// UpdateRequest represents the request body for retargeting a shortened URL
+type UpdateRequest struct {
+	URL string `json:"url"`
+
+	// Actor is the name of the API key making the change, or "admin"
+	Actor string `json:"-"`
+}
+
+// URLRevision represents a change of destination for a shortened URL
+type URLRevision struct {
+	PreviousURL string    `json:"previous_url,omitempty"`
+	NewURL      string    `json:"new_url,omitempty"`
+	ChangedAt   time.Time `json:"changed_at"`
+	Actor       string    `json:"actor"`
+}
+
+// URLHistory represents the revision history of a shortened URL.
+// Destinations are left empty for password-protected links.
+type URLHistory struct {
+	ShortCode   string        `json:"short_code"`
+	OriginalURL string        `json:"original_url,omitempty"`
+	Revisions   []URLRevision `json:"revisions"`
 }
 
 // obfuscateID applies a reversible transformation to make IDs non-sequential
@@ -89,6 +212,84 @@ func generateShortCode(id int64) string {
 	return encodeBase62(obfuscated)
 }
 
+// decodeBase62 converts a base62 string back to an integer.
+// It reports false for strings that encodeBase62 would never produce.
+func decodeBase62(s string) (int64, bool) {
+	if s == "" || (len(s) > 1 && s[0] == base62Chars[0]) {
+		return 0, false
+	}
+
+	var num int64
+	base := int64(len(base62Chars))
+
+	for i := 0; i < len(s); i++ {
+		digit := strings.IndexByte(base62Chars, s[i])
+		if digit < 0 {
+			return 0, false
+		}
+		num = num*base + int64(digit)
+		if num >= maxGeneratedValue {
+			return 0, false
+		}
+	}
+
+	return num, true
+}
+
+// isGeneratedCode reports whether generateShortCode could return code for some ID.
+// obfuscateID is a bijection over [0, maxGeneratedValue), so every canonical
+// base62 string below that bound is reachable.
+func isGeneratedCode(code string) bool {
+	_, ok := decodeBase62(code)
+	return ok
+}
+
+// validateAlias checks a custom alias against the charset, length and reserved word policy
+func validateAlias(alias string) error {
+	if reservedAliases[strings.ToLower(alias)] ||
+		strings.HasSuffix(alias, "/stats") || strings.HasSuffix(alias, "/qr") {
+		return fmt.Errorf("alias %q is reserved", alias)
+	}
+
+	if len(alias) < aliasMinLength || len(alias) > aliasMaxLength {
+		return fmt.Errorf("alias must be between %d and %d characters", aliasMinLength, aliasMaxLength)
+	}
+
+	for i := 0; i < len(alias); i++ {
+		c := alias[i]
+		switch {
+		case (c >= '0' && c <= '9') || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z'):
+		case (c == '-' || c == '_') && i > 0:
+		default:
+			return fmt.Errorf("alias may only contain letters, digits, '-' and '_' and must start with a letter or digit")
+		}
+	}
+
+	return nil
+}
+
+// hashPassword returns a salted bcrypt hash of password, or "" if no password is set
+func hashPassword(password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err == bcrypt.ErrPasswordTooLong {
+		return "", fmt.Errorf("password must be at most 72 bytes")
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	return string(hash), nil
+}
+
+// checkPassword reports whether password matches the link's stored hash
+func (r *URLRecord) checkPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(r.PasswordHash), []byte(password)) == nil
+}
+
 // validateURL checks if the provided URL is valid
 func validateURL(rawURL string) error {
 	if rawURL == "" {
@@ -114,207 +315,288 @@ func validateURL(rawURL string) error {
 	return nil
 }
 
+// reuseKey normalizes a destination for sharing links: the scheme and host
+// are case-insensitive and default ports are implied. Links created with an
+// API key are only shared with that key, which is allowed to manage them.
+func reuseKey(destination string, apiKeyID int64) string {
+	if apiKeyID != 0 {
+		return fmt.Sprintf("%d:%s", apiKeyID, reuseKey(destination, 0))
+	}
+
+	u, err := url.Parse(destination)
+	if err != nil {
+		return destination
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if port := u.Port(); (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		u.Host = strings.TrimSuffix(u.Host, ":"+port)
+	}
+
+	return u.String()
+}
+
 // createShortURL creates a new shortened URL entry
-func (a *App) createShortURL(req *ShortenRequest) (*ShortenResponse, error) {
+func (a *App) createShortURL(ctx context.Context, req *ShortenRequest) (_ *ShortenResponse, err error) {
+	ctx, span := a.tracer.Start(ctx, "createShortURL")
+	defer func() { endSpan(span, err) }()
+
+	logger := loggerFromContext(ctx)
+
 	// Validate URL
 	if err := validateURL(req.URL); err != nil {
 		return nil, err
 	}
 
-	// Check if URL already exists
-	var existingID int64
-	err := a.db.QueryRow("SELECT id FROM urls WHERE original_url = ?", req.URL).Scan(&existingID)
-	if err == nil {
-		// URL already exists, return existing short code
-		shortCode := generateShortCode(existingID)
-
-		var record URLRecord
-		err = a.db.QueryRow(
-			"SELECT id, short_code, original_url, created_at FROM urls WHERE id = ?",
-			existingID,
-		).Scan(&record.ID, &record.ShortCode, &record.OriginalURL, &record.CreatedAt)
-		if err != nil {
-			return nil, fmt.Errorf("failed to fetch existing record: %w", err)
-		}
-
-		return &ShortenResponse{
-			ShortCode:   shortCode,
-			ShortURL:    fmt.Sprintf("%s/%s", a.config.BaseURL, shortCode),
-			OriginalURL: record.OriginalURL,
-			CreatedAt:   record.CreatedAt,
-		}, nil
-	} else if err != sql.ErrNoRows {
-		return nil, fmt.Errorf("database error: %w", err)
-	}
-
-	// Insert URL (short_code will be generated after we have the ID)
-	result, err := a.db.Exec(
-		"INSERT INTO urls (short_code, original_url) VALUES (?, ?)",
-		"", req.URL,
-	)
+	destination, chain, err := a.resolveDestination(ctx, req.URL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to insert URL: %w", err)
+		return nil, err
+	}
+	if len(chain) > 0 {
+		logger.Info("Resolved shortener link", "url", req.URL, "destination", destination, "hops", len(chain))
 	}
 
-	// Get the auto-generated ID
-	id, err := result.LastInsertId()
+	if err := a.checkDestination(ctx, destination); err != nil {
+		return nil, err
+	}
+
+	if err := a.checkPolicy(destination); err != nil {
+		return nil, err
+	}
+
+	expiresAt, err := req.expiry(time.Now())
 	if err != nil {
-		return nil, fmt.Errorf("failed to get last insert ID: %w", err)
+		return nil, err
 	}
 
-	// Generate collision-free, non-enumerable short code
-	shortCode := generateShortCode(id)
+	if req.MaxClicks < 0 {
+		return nil, fmt.Errorf("max_clicks must be positive")
+	}
 
-	// Update with the actual short code
-	_, err = a.db.Exec(
-		"UPDATE urls SET short_code = ? WHERE id = ?",
-		shortCode, id,
-	)
+	passwordHash, err := hashPassword(req.Password)
 	if err != nil {
-		return nil, fmt.Errorf("failed to update short code: %w", err)
+		return nil, err
+	}
+
+	var reuse string
+	if req.Alias != "" {
+		if err := a.checkAlias(ctx, req.Alias); err != nil {
+			return nil, err
+		}
+	} else if expiresAt == nil && req.MaxClicks == 0 && passwordHash == "" && len(chain) == 0 {
+		// Links with any options are never reused
+		reuse = reuseKey(destination, req.APIKeyID)
 	}
 
-	// Fetch the final record
-	var record URLRecord
-	err = a.db.QueryRow(
-		"SELECT id, short_code, original_url, created_at FROM urls WHERE id = ?",
-		id,
-	).Scan(&record.ID, &record.ShortCode, &record.OriginalURL, &record.CreatedAt)
+	record, created, err := a.store.CreateURL(ctx, &NewURL{
+		ShortCode:     req.Alias,
+		OriginalURL:   destination,
+		ExpiresAt:     expiresAt,
+		MaxClicks:     req.MaxClicks,
+		PasswordHash:  passwordHash,
+		APIKeyID:      req.APIKeyID,
+		RedirectChain: chain,
+		ReuseKey:      reuse,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch created record: %w", err)
+		return nil, err
+	}
+
+	if !created {
+		logger.Debug("Reusing existing short code", "short_code", record.ShortCode)
+		return a.shortenResponse(record), nil
 	}
 
+	// The short code may have been cached as unknown before it existed
+	a.urls.invalidate(record.ShortCode)
+
+	return a.shortenResponse(record), nil
+}
+
+// shortenResponse builds the API response for a stored record
+func (a *App) shortenResponse(record *URLRecord) *ShortenResponse {
 	return &ShortenResponse{
-		ShortCode:   record.ShortCode,
-		ShortURL:    fmt.Sprintf("%s/%s", a.config.BaseURL, record.ShortCode),
-		OriginalURL: record.OriginalURL,
-		CreatedAt:   record.CreatedAt,
-	}, nil
+		ShortCode:         record.ShortCode,
+		ShortURL:          fmt.Sprintf("%s/%s", a.config.BaseURL, record.ShortCode),
+		OriginalURL:       record.OriginalURL,
+		CreatedAt:         record.CreatedAt,
+		ExpiresAt:         record.ExpiresAt,
+		MaxClicks:         record.MaxClicks,
+		PasswordProtected: record.PasswordHash != "",
+	}
+}
+
+// checkAlias validates a custom alias and makes sure it is free to use
+func (a *App) checkAlias(ctx context.Context, alias string) error {
+	if err := validateAlias(alias); err != nil {
+		return err
+	}
+
+	// Generated codes own the canonical base62 space below maxGeneratedValue
+	if isGeneratedCode(alias) {
+		return fmt.Errorf("%w: %q is reserved for generated short codes", ErrAliasConflict, alias)
+	}
+
+	_, err := a.store.GetURL(ctx, alias)
+	if err == nil {
+		return fmt.Errorf("%w: %q is already in use", ErrAliasConflict, alias)
+	}
+	if err != ErrNotFound {
+		return err
+	}
+
+	return nil
 }
 
 // getURL retrieves a URL by its short code
-func (a *App) getURL(shortCode string) (*URLRecord, error) {
-	// We can either lookup by short_code or decode it to get ID
-	// Using short_code lookup is more straightforward
-	var record URLRecord
-
-	err := a.db.QueryRow(`
-		SELECT id, short_code, original_url, created_at, clicks, last_clicked_at
-		FROM urls
-		WHERE short_code = ?
-	`, shortCode).Scan(
-		&record.ID,
-		&record.ShortCode,
-		&record.OriginalURL,
-		&record.CreatedAt,
-		&record.Clicks,
-		&record.LastClickedAt,
-	)
-
-	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("short code not found")
+func (a *App) getURL(ctx context.Context, shortCode string) (_ *URLRecord, err error) {
+	_, span := a.tracer.Start(ctx, "getURL", trace.WithAttributes(attribute.String("ul.short_code", shortCode)))
+	defer func() { endSpan(span, err) }()
+	defer a.metrics.observeQuery("get_url", time.Now())
+
+	return a.store.GetURL(ctx, shortCode)
+}
+
+// updateURL points a short code at a new destination and records the previous one
+func (a *App) updateURL(ctx context.Context, shortCode string, req *UpdateRequest) (*URLRecord, error) {
+	if err := validateURL(req.URL); err != nil {
+		return nil, err
 	}
+
+	destination, chain, err := a.resolveDestination(ctx, req.URL)
 	if err != nil {
-		return nil, fmt.Errorf("database error: %w", err)
+		return nil, err
 	}
 
-	return &record, nil
-}
+	if err := a.checkDestination(ctx, destination); err != nil {
+		return nil, err
+	}
 
-// trackClick records a click event and updates statistics
-func (a *App) trackClick(urlID int64, userAgent, referer string) error {
-	tx, err := a.db.Begin()
+	if err := a.checkPolicy(destination); err != nil {
+		return nil, err
+	}
+
+	changed, err := a.store.UpdateURL(ctx, shortCode, destination, chain, req.Actor)
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+		return nil, err
+	}
+	if changed {
+		a.urls.invalidate(shortCode)
 	}
-	defer tx.Rollback()
 
-	// Insert click record
-	_, err = tx.Exec(`
-		INSERT INTO clicks (url_id, user_agent, referer)
-		VALUES (?, ?, ?)
-	`, urlID, userAgent, referer)
+	return a.getURL(ctx, shortCode)
+}
+
+// setDisabled soft-disables or re-enables a shortened URL
+func (a *App) setDisabled(ctx context.Context, shortCode string, disabled bool) error {
+	defer a.metrics.observeQuery("set_disabled", time.Now())
+
+	if err := a.store.SetDisabled(ctx, shortCode, disabled); err != nil {
+		return err
+	}
+
+	a.urls.invalidate(shortCode)
+	return nil
+}
+
+// deleteURL permanently removes a shortened URL along with its clicks and revisions
+func (a *App) deleteURL(ctx context.Context, shortCode string) error {
+	defer a.metrics.observeQuery("delete_url", time.Now())
+
+	if err := a.store.DeleteURL(ctx, shortCode); err != nil {
+		return err
+	}
+
+	a.urls.invalidate(shortCode)
+	return nil
+}
+
+// getHistory retrieves the revision history of a shortened URL, newest first
+func (a *App) getHistory(ctx context.Context, shortCode string) (*URLHistory, error) {
+	record, err := a.getURL(ctx, shortCode)
 	if err != nil {
-		return fmt.Errorf("failed to insert click record: %w", err)
+		return nil, err
 	}
 
-	// Update URL statistics
-	_, err = tx.Exec(`
-		UPDATE urls
-		SET clicks = clicks + 1, last_clicked_at = CURRENT_TIMESTAMP
-		WHERE id = ?
-	`, urlID)
+	revisions, err := a.store.GetRevisions(ctx, record.ID)
 	if err != nil {
-		return fmt.Errorf("failed to update URL statistics: %w", err)
+		return nil, err
 	}
 
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+	history := &URLHistory{
+		ShortCode:   record.ShortCode,
+		OriginalURL: record.OriginalURL,
+		Revisions:   revisions,
+	}
+
+	// Don't reveal where a password-protected link points
+	if record.PasswordHash != "" {
+		history.OriginalURL = ""
+		for i := range history.Revisions {
+			history.Revisions[i].PreviousURL = ""
+			history.Revisions[i].NewURL = ""
+		}
+	}
+
+	return history, nil
+}
+
+// Click is a single visit to a shortened URL
+type Click struct {
+	URLID     int64
+	UserAgent string
+	Referer   string
+	// VisitorHash is the daily-salted hash of the client's IP and user agent,
+	// computed when the click happens so queued clicks use the salt of their day
+	VisitorHash string
+	// IsBot marks crawlers, link previews and prefetches, which are recorded
+	// but don't count towards clicks or click limits
+	IsBot bool
+	// Time is when the click happened, used when it is written later by the click queue
+	Time time.Time
+}
+
+// trackClick records a click event and updates statistics.
+// For click-limited links the counter is only bumped while it is below
+// max_clicks, so concurrent callers can never exceed the limit; once it is
+// reached ErrClickLimitReached is returned and nothing is recorded. Bots
+// don't use up clicks, but are refused in the same way once none are left.
+func (a *App) trackClick(ctx context.Context, click *Click) (err error) {
+	_, span := a.tracer.Start(ctx, "trackClick", trace.WithAttributes(
+		attribute.Int64("ul.url_id", click.URLID),
+		attribute.Bool("ul.bot", click.IsBot),
+	))
+	defer func() { endSpan(span, err) }()
+	defer a.metrics.observeQuery("track_click", time.Now())
+
+	if err := a.store.TrackClick(ctx, click); err != nil {
+		return err
 	}
 
+	loggerFromContext(ctx).Debug("Click tracked", "url_id", click.URLID, "bot", click.IsBot)
 	return nil
 }
 
 // getStats retrieves statistics for a shortened URL
-func (a *App) getStats(shortCode string) (*URLStats, error) {
-	var stats URLStats
-
-	err := a.db.QueryRow(`
-		SELECT short_code, original_url, created_at, clicks, last_clicked_at
-		FROM urls
-		WHERE short_code = ?
-	`, shortCode).Scan(
-		&stats.ShortCode,
-		&stats.OriginalURL,
-		&stats.CreatedAt,
-		&stats.TotalClicks,
-		&stats.LastClickedAt,
-	)
-
-	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("short code not found")
-	}
+func (a *App) getStats(ctx context.Context, shortCode string) (*URLStats, error) {
+	defer a.metrics.observeQuery("get_stats", time.Now())
+
+	stats, err := a.store.GetStats(ctx, shortCode)
 	if err != nil {
-		return nil, fmt.Errorf("database error: %w", err)
-	}
-
-	return &stats, nil
-}
-
-// initDB initializes the database schema
-func (a *App) initDB() error {
-	schema := `
-		CREATE TABLE IF NOT EXISTS urls (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			short_code TEXT NOT NULL UNIQUE,
-			original_url TEXT NOT NULL,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			clicks INTEGER DEFAULT 0,
-			last_clicked_at DATETIME
-		);
-
-		CREATE INDEX IF NOT EXISTS idx_short_code ON urls(short_code);
-		CREATE INDEX IF NOT EXISTS idx_original_url ON urls(original_url);
-		CREATE INDEX IF NOT EXISTS idx_created_at ON urls(created_at);
-
-		CREATE TABLE IF NOT EXISTS clicks (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			url_id INTEGER NOT NULL,
-			clicked_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			user_agent TEXT,
-			referer TEXT,
-			FOREIGN KEY (url_id) REFERENCES urls(id) ON DELETE CASCADE
-		);
-
-		CREATE INDEX IF NOT EXISTS idx_clicks_url_id ON clicks(url_id);
-		CREATE INDEX IF NOT EXISTS idx_clicks_clicked_at ON clicks(clicked_at);
-	`
-
-	_, err := a.db.Exec(schema)
+		return nil, err
+	}
+
+	stats.UniqueVisitors, err = a.getUniqueVisitors(ctx, shortCode, time.Now())
 	if err != nil {
-		return fmt.Errorf("failed to initialize database: %w", err)
+		return nil, err
 	}
 
-	log.Info("Database schema initialized")
-	return nil
+	// Don't reveal where a password-protected link points
+	if stats.PasswordProtected {
+		stats.OriginalURL = ""
+		stats.RedirectChain = nil
+	}
+
+	return stats, nil
 }
@@ -2,6 +2,10 @@ package main
 
 import (
 	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -107,11 +111,11 @@ func TestValidateURL(t *testing.T) {
 
 func TestCreateShortURL(t *testing.T) {
 	app := setupTestApp(t)
-	defer app.db.Close()
+	defer app.store.Close()
 
 	// Test creating new URL
 	req := &ShortenRequest{URL: "https://www.example.com/create-test"}
-	resp, err := app.createShortURL(req)
+	resp, err := app.createShortURL(context.Background(), req)
 	if err != nil {
 		t.Fatalf("Failed to create short URL: %v", err)
 	}
@@ -131,7 +135,7 @@ func TestCreateShortURL(t *testing.T) {
 
 func TestCreateShortURL_InvalidURL(t *testing.T) {
 	app := setupTestApp(t)
-	defer app.db.Close()
+	defer app.store.Close()
 
 	testCases := []struct {
 		url  string
@@ -145,7 +149,7 @@ func TestCreateShortURL_InvalidURL(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			req := &ShortenRequest{URL: tc.url}
-			_, err := app.createShortURL(req)
+			_, err := app.createShortURL(context.Background(), req)
 			if err == nil {
 				t.Errorf("Expected error for URL '%s', got nil", tc.url)
 			}
@@ -155,20 +159,20 @@ func TestCreateShortURL_InvalidURL(t *testing.T) {
 
 func TestCreateShortURL_Idempotent(t *testing.T) {
 	app := setupTestApp(t)
-	defer app.db.Close()
+	defer app.store.Close()
 
 	url := "https://www.example.com/idempotent-test"
 
 	// Create first time
 	req1 := &ShortenRequest{URL: url}
-	resp1, err := app.createShortURL(req1)
+	resp1, err := app.createShortURL(context.Background(), req1)
 	if err != nil {
 		t.Fatalf("Failed to create short URL: %v", err)
 	}
 
 	// Create second time with same URL
 	req2 := &ShortenRequest{URL: url}
-	resp2, err := app.createShortURL(req2)
+	resp2, err := app.createShortURL(context.Background(), req2)
 	if err != nil {
 		t.Fatalf("Failed to create short URL second time: %v", err)
 	}
@@ -184,19 +188,72 @@ func TestCreateShortURL_Idempotent(t *testing.T) {
 	}
 }
 
+func TestCreateShortURL_Concurrent(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	url := "https://www.example.com/concurrent-test"
+
+	var wg sync.WaitGroup
+	codes := make([]string, 50)
+	for i := range codes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := app.createShortURL(context.Background(), &ShortenRequest{URL: url})
+			if err != nil {
+				t.Errorf("Failed to create short URL: %v", err)
+				return
+			}
+			codes[i] = resp.ShortCode
+		}()
+	}
+	wg.Wait()
+
+	for _, code := range codes {
+		if code != codes[0] {
+			t.Errorf("Expected one short code, got '%s' and '%s'", codes[0], code)
+		}
+	}
+
+	var count int
+	if err := testDB(app).QueryRow("SELECT COUNT(*) FROM urls WHERE original_url = ?", url).Scan(&count); err != nil || count != 1 {
+		t.Errorf("Expected one stored URL, got %d: %v", count, err)
+	}
+}
+
+func TestReuseKey(t *testing.T) {
+	tests := map[string]string{
+		"https://example.com/path?q=1": "https://example.com/path?q=1",
+		"HTTPS://Example.COM/Path":     "https://example.com/Path",
+		"https://example.com:443/":     "https://example.com/",
+		"http://example.com:80":        "http://example.com",
+		"http://example.com:443/":      "http://example.com:443/",
+		"http://[::1]:80/":             "http://[::1]/",
+	}
+	for destination, want := range tests {
+		if got := reuseKey(destination, 0); got != want {
+			t.Errorf("reuseKey(%q) = %q, want %q", destination, got, want)
+		}
+	}
+	if got := reuseKey("HTTPS://Example.COM/", 7); got != "7:https://example.com/" {
+		t.Errorf("Expected key-scoped reuse key, got %q", got)
+	}
+}
+
 func TestGetURL(t *testing.T) {
 	app := setupTestApp(t)
-	defer app.db.Close()
+	defer app.store.Close()
 
 	// Create a URL first
 	req := &ShortenRequest{URL: "https://www.example.com/get-test"}
-	resp, err := app.createShortURL(req)
+	resp, err := app.createShortURL(context.Background(), req)
 	if err != nil {
 		t.Fatalf("Failed to create short URL: %v", err)
 	}
 
 	// Retrieve it
-	record, err := app.getURL(resp.ShortCode)
+	record, err := app.getURL(context.Background(), resp.ShortCode)
 	if err != nil {
 		t.Fatalf("Failed to get URL: %v", err)
 	}
@@ -216,9 +273,9 @@ func TestGetURL(t *testing.T) {
 
 func TestGetURL_NotFound(t *testing.T) {
 	app := setupTestApp(t)
-	defer app.db.Close()
+	defer app.store.Close()
 
-	_, err := app.getURL("nonexistent")
+	_, err := app.getURL(context.Background(), "nonexistent")
 	if err == nil {
 		t.Error("Expected error for non-existent short code, got nil")
 	}
@@ -230,9 +287,9 @@ func TestGetURL_NotFound(t *testing.T) {
 
 func TestGetURL_EmptyShortCode(t *testing.T) {
 	app := setupTestApp(t)
-	defer app.db.Close()
+	defer app.store.Close()
 
-	_, err := app.getURL("")
+	_, err := app.getURL(context.Background(), "")
 	if err == nil {
 		t.Error("Expected error for empty short code, got nil")
 	}
@@ -240,17 +297,17 @@ func TestGetURL_EmptyShortCode(t *testing.T) {
 
 func TestTrackClick(t *testing.T) {
 	app := setupTestApp(t)
-	defer app.db.Close()
+	defer app.store.Close()
 
 	// Create a URL
 	req := &ShortenRequest{URL: "https://www.example.com/track-test"}
-	resp, err := app.createShortURL(req)
+	resp, err := app.createShortURL(context.Background(), req)
 	if err != nil {
 		t.Fatalf("Failed to create short URL: %v", err)
 	}
 
 	// Get the URL to find its ID
-	record, err := app.getURL(resp.ShortCode)
+	record, err := app.getURL(context.Background(), resp.ShortCode)
 	if err != nil {
 		t.Fatalf("Failed to get URL: %v", err)
 	}
@@ -258,13 +315,13 @@ func TestTrackClick(t *testing.T) {
 	// Track a click
 	userAgent := "Test-Agent/1.0"
 	referer := "https://test.com"
-	err = app.trackClick(record.ID, userAgent, referer)
+	err = app.trackClick(context.Background(), &Click{URLID: record.ID, UserAgent: userAgent, Referer: referer})
 	if err != nil {
 		t.Fatalf("Failed to track click: %v", err)
 	}
 
 	// Verify the click was tracked
-	updatedRecord, err := app.getURL(resp.ShortCode)
+	updatedRecord, err := app.getURL(context.Background(), resp.ShortCode)
 	if err != nil {
 		t.Fatalf("Failed to get updated URL: %v", err)
 	}
@@ -280,30 +337,30 @@ func TestTrackClick(t *testing.T) {
 
 func TestTrackClick_MultipleClicks(t *testing.T) {
 	app := setupTestApp(t)
-	defer app.db.Close()
+	defer app.store.Close()
 
 	// Create a URL
 	req := &ShortenRequest{URL: "https://www.example.com/multi-click-test"}
-	resp, err := app.createShortURL(req)
+	resp, err := app.createShortURL(context.Background(), req)
 	if err != nil {
 		t.Fatalf("Failed to create short URL: %v", err)
 	}
 
-	record, err := app.getURL(resp.ShortCode)
+	record, err := app.getURL(context.Background(), resp.ShortCode)
 	if err != nil {
 		t.Fatalf("Failed to get URL: %v", err)
 	}
 
 	// Track multiple clicks
 	for i := 0; i < 5; i++ {
-		err = app.trackClick(record.ID, "Test-Agent", "https://test.com")
+		err = app.trackClick(context.Background(), &Click{URLID: record.ID, UserAgent: "Test-Agent", Referer: "https://test.com"})
 		if err != nil {
 			t.Fatalf("Failed to track click %d: %v", i+1, err)
 		}
 	}
 
 	// Verify all clicks were tracked
-	updatedRecord, err := app.getURL(resp.ShortCode)
+	updatedRecord, err := app.getURL(context.Background(), resp.ShortCode)
 	if err != nil {
 		t.Fatalf("Failed to get updated URL: %v", err)
 	}
@@ -315,28 +372,28 @@ func TestTrackClick_MultipleClicks(t *testing.T) {
 
 func TestTrackClick_EmptyUserAgent(t *testing.T) {
 	app := setupTestApp(t)
-	defer app.db.Close()
+	defer app.store.Close()
 
 	// Create a URL
 	req := &ShortenRequest{URL: "https://www.example.com/empty-ua-test"}
-	resp, err := app.createShortURL(req)
+	resp, err := app.createShortURL(context.Background(), req)
 	if err != nil {
 		t.Fatalf("Failed to create short URL: %v", err)
 	}
 
-	record, err := app.getURL(resp.ShortCode)
+	record, err := app.getURL(context.Background(), resp.ShortCode)
 	if err != nil {
 		t.Fatalf("Failed to get URL: %v", err)
 	}
 
 	// Track click with empty user agent
-	err = app.trackClick(record.ID, "", "")
+	err = app.trackClick(context.Background(), &Click{URLID: record.ID})
 	if err != nil {
 		t.Fatalf("Failed to track click with empty user agent: %v", err)
 	}
 
 	// Verify click was tracked
-	updatedRecord, err := app.getURL(resp.ShortCode)
+	updatedRecord, err := app.getURL(context.Background(), resp.ShortCode)
 	if err != nil {
 		t.Fatalf("Failed to get updated URL: %v", err)
 	}
@@ -348,30 +405,30 @@ func TestTrackClick_EmptyUserAgent(t *testing.T) {
 
 func TestGetStats(t *testing.T) {
 	app := setupTestApp(t)
-	defer app.db.Close()
+	defer app.store.Close()
 
 	// Create a URL
 	req := &ShortenRequest{URL: "https://www.example.com/stats-func-test"}
-	resp, err := app.createShortURL(req)
+	resp, err := app.createShortURL(context.Background(), req)
 	if err != nil {
 		t.Fatalf("Failed to create short URL: %v", err)
 	}
 
 	// Track some clicks
-	record, err := app.getURL(resp.ShortCode)
+	record, err := app.getURL(context.Background(), resp.ShortCode)
 	if err != nil {
 		t.Fatalf("Failed to get URL: %v", err)
 	}
 
 	for i := 0; i < 3; i++ {
-		err = app.trackClick(record.ID, "Test-Agent", "https://test.com")
+		err = app.trackClick(context.Background(), &Click{URLID: record.ID, UserAgent: "Test-Agent", Referer: "https://test.com"})
 		if err != nil {
 			t.Fatalf("Failed to track click: %v", err)
 		}
 	}
 
 	// Get stats
-	stats, err := app.getStats(resp.ShortCode)
+	stats, err := app.getStats(context.Background(), resp.ShortCode)
 	if err != nil {
 		t.Fatalf("Failed to get stats: %v", err)
 	}
@@ -395,9 +452,9 @@ func TestGetStats(t *testing.T) {
 
 func TestGetStats_NotFound(t *testing.T) {
 	app := setupTestApp(t)
-	defer app.db.Close()
+	defer app.store.Close()
 
-	_, err := app.getStats("nonexistent")
+	_, err := app.getStats(context.Background(), "nonexistent")
 	if err == nil {
 		t.Error("Expected error for non-existent short code, got nil")
 	}
@@ -405,17 +462,17 @@ func TestGetStats_NotFound(t *testing.T) {
 
 func TestGetStats_NoClicks(t *testing.T) {
 	app := setupTestApp(t)
-	defer app.db.Close()
+	defer app.store.Close()
 
 	// Create a URL but don't track any clicks
 	req := &ShortenRequest{URL: "https://www.example.com/no-clicks-test"}
-	resp, err := app.createShortURL(req)
+	resp, err := app.createShortURL(context.Background(), req)
 	if err != nil {
 		t.Fatalf("Failed to create short URL: %v", err)
 	}
 
 	// Get stats
-	stats, err := app.getStats(resp.ShortCode)
+	stats, err := app.getStats(context.Background(), resp.ShortCode)
 	if err != nil {
 		t.Fatalf("Failed to get stats: %v", err)
 	}
@@ -440,16 +497,16 @@ func TestInitDB(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed to create app: %v", err)
 	}
-	defer app.db.Close()
+	defer app.store.Close()
 
 	// Verify tables were created by attempting to insert
-	_, err = app.db.Exec("INSERT INTO urls (short_code, original_url) VALUES (?, ?)", "test", "https://example.com")
+	_, err = testDB(app).Exec("INSERT INTO urls (short_code, original_url) VALUES (?, ?)", "test", "https://example.com")
 	if err != nil {
 		t.Errorf("Failed to insert into urls table: %v", err)
 	}
 
 	// Verify clicks table
-	_, err = app.db.Exec("INSERT INTO clicks (url_id, user_agent, referer) VALUES (?, ?, ?)", 1, "test", "test")
+	_, err = testDB(app).Exec("INSERT INTO clicks (url_id, user_agent, referer) VALUES (?, ?, ?)", 1, "test", "test")
 	if err != nil {
 		t.Errorf("Failed to insert into clicks table: %v", err)
 	}
@@ -478,11 +535,11 @@ func TestValidateURL_EdgeCases(t *testing.T) {
 
 func TestURLRecordTimestamps(t *testing.T) {
 	app := setupTestApp(t)
-	defer app.db.Close()
+	defer app.store.Close()
 
 	// Create a URL
 	req := &ShortenRequest{URL: "https://www.example.com/timestamp-test"}
-	resp, err := app.createShortURL(req)
+	resp, err := app.createShortURL(context.Background(), req)
 	if err != nil {
 		t.Fatalf("Failed to create short URL: %v", err)
 	}
@@ -497,3 +554,494 @@ func TestURLRecordTimestamps(t *testing.T) {
 		t.Error("Created timestamp is too old")
 	}
 }
+
+func TestDecodeBase62(t *testing.T) {
+	for _, num := range []int64{0, 1, 61, 62, 3844, 999999} {
+		decoded, ok := decodeBase62(encodeBase62(num))
+		if !ok || decoded != num {
+			t.Errorf("Expected %d to round-trip, got %d (ok=%v)", num, decoded, ok)
+		}
+	}
+
+	for _, s := range []string{"", "00", "0a", "a-b", "zzzzzzzz"} {
+		if _, ok := decodeBase62(s); ok {
+			t.Errorf("Expected '%s' to be rejected", s)
+		}
+	}
+}
+
+func TestIsGeneratedCode(t *testing.T) {
+	for i := int64(1); i <= 100; i++ {
+		code := generateShortCode(i)
+		if !isGeneratedCode(code) {
+			t.Errorf("Expected generated code '%s' to be detected", code)
+		}
+	}
+
+	for _, alias := range []string{"q3-roadmap", "roadmap2025", "my_link"} {
+		if isGeneratedCode(alias) {
+			t.Errorf("Expected alias '%s' not to be a generated code", alias)
+		}
+	}
+}
+
+func TestValidateAlias(t *testing.T) {
+	testCases := []struct {
+		alias     string
+		shouldErr bool
+		name      string
+	}{
+		{"q3-roadmap", false, "dashes"},
+		{"team_docs", false, "underscores"},
+		{"ab", true, "too short"},
+		{strings.Repeat("a", 65), true, "too long"},
+		{"-roadmap", true, "leading dash"},
+		{"road map", true, "space"},
+		{"road/map", true, "slash"},
+		{"health", true, "reserved health"},
+		{"Metrics", true, "reserved metrics"},
+		{"readyz", true, "reserved readyz"},
+		{"s", true, "reserved s"},
+		{"foo/stats", true, "stats suffix"},
+		{"foo/qr", true, "qr suffix"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateAlias(tc.alias)
+			if tc.shouldErr && err == nil {
+				t.Errorf("Expected error for alias '%s', got nil", tc.alias)
+			}
+			if !tc.shouldErr && err != nil {
+				t.Errorf("Expected no error for alias '%s', got: %v", tc.alias, err)
+			}
+		})
+	}
+}
+
+func TestCreateShortURL_Alias(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	req := &ShortenRequest{URL: "https://www.example.com/alias-test", Alias: "q3-roadmap"}
+	resp, err := app.createShortURL(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Failed to create aliased URL: %v", err)
+	}
+
+	if resp.ShortCode != "q3-roadmap" {
+		t.Errorf("Expected short code 'q3-roadmap', got '%s'", resp.ShortCode)
+	}
+
+	if resp.ShortURL != "http://localhost:7000/q3-roadmap" {
+		t.Errorf("Expected short URL 'http://localhost:7000/q3-roadmap', got '%s'", resp.ShortURL)
+	}
+
+	// Shortening the same URL without an alias must not return the alias
+	plain, err := app.createShortURL(context.Background(), &ShortenRequest{URL: req.URL})
+	if err != nil {
+		t.Fatalf("Failed to create plain URL: %v", err)
+	}
+
+	if plain.ShortCode == resp.ShortCode {
+		t.Error("Expected plain shortening to get its own generated code")
+	}
+
+	record, err := app.getURL(context.Background(), "q3-roadmap")
+	if err != nil {
+		t.Fatalf("Failed to get aliased URL: %v", err)
+	}
+
+	if record.OriginalURL != req.URL {
+		t.Errorf("Expected original URL '%s', got '%s'", req.URL, record.OriginalURL)
+	}
+}
+
+func TestCreateShortURL_AliasConflict(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	_, err := app.createShortURL(context.Background(), &ShortenRequest{URL: "https://www.example.com/first", Alias: "taken-alias"})
+	if err != nil {
+		t.Fatalf("Failed to create aliased URL: %v", err)
+	}
+
+	testCases := []struct {
+		alias string
+		name  string
+	}{
+		{"taken-alias", "existing alias"},
+		{"abc", "generated code space"},
+		{generateShortCode(12345), "future generated code"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := app.createShortURL(context.Background(), &ShortenRequest{URL: "https://www.example.com/second", Alias: tc.alias})
+			if !errors.Is(err, ErrAliasConflict) {
+				t.Errorf("Expected ErrAliasConflict for alias '%s', got: %v", tc.alias, err)
+			}
+		})
+	}
+}
+
+func TestShortenRequestExpiry(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	future := now.Add(time.Hour)
+	past := now.Add(-time.Hour)
+
+	testCases := []struct {
+		req       ShortenRequest
+		expected  *time.Time
+		shouldErr bool
+		name      string
+	}{
+		{ShortenRequest{}, nil, false, "no expiry"},
+		{ShortenRequest{TTLSeconds: 3600}, &future, false, "ttl"},
+		{ShortenRequest{ExpiresAt: &future}, &future, false, "expires_at"},
+		{ShortenRequest{TTLSeconds: -1}, nil, true, "negative ttl"},
+		{ShortenRequest{ExpiresAt: &past}, nil, true, "past expires_at"},
+		{ShortenRequest{ExpiresAt: &future, TTLSeconds: 60}, nil, true, "both set"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			expiresAt, err := tc.req.expiry(now)
+			if tc.shouldErr {
+				if err == nil {
+					t.Error("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if (expiresAt == nil) != (tc.expected == nil) || (expiresAt != nil && !expiresAt.Equal(*tc.expected)) {
+				t.Errorf("Expected expiry %v, got %v", tc.expected, expiresAt)
+			}
+		})
+	}
+}
+
+func TestCreateShortURL_WithTTL(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	url := "https://www.example.com/ttl-test"
+	resp, err := app.createShortURL(context.Background(), &ShortenRequest{URL: url, TTLSeconds: 3600})
+	if err != nil {
+		t.Fatalf("Failed to create expiring URL: %v", err)
+	}
+
+	if resp.ExpiresAt == nil {
+		t.Fatal("Expected expires_at to be set")
+	}
+
+	if d := time.Until(*resp.ExpiresAt); d <= 59*time.Minute || d > time.Hour {
+		t.Errorf("Expected expiry about an hour from now, got %v", d)
+	}
+
+	// Expiring links are not reused for plain shortening
+	plain, err := app.createShortURL(context.Background(), &ShortenRequest{URL: url})
+	if err != nil {
+		t.Fatalf("Failed to create plain URL: %v", err)
+	}
+
+	if plain.ShortCode == resp.ShortCode || plain.ExpiresAt != nil {
+		t.Error("Expected plain shortening to get its own non-expiring code")
+	}
+
+	stats, err := app.getStats(context.Background(), resp.ShortCode)
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+
+	if stats.ExpiresAt == nil || !stats.ExpiresAt.Equal(*resp.ExpiresAt) {
+		t.Errorf("Expected stats expires_at %v, got %v", resp.ExpiresAt, stats.ExpiresAt)
+	}
+}
+
+func TestTrackClick_ClickLimit(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	resp, err := app.createShortURL(context.Background(), &ShortenRequest{URL: "https://www.example.com/limit-test", MaxClicks: 2})
+	if err != nil {
+		t.Fatalf("Failed to create short URL: %v", err)
+	}
+
+	if resp.MaxClicks == nil || *resp.MaxClicks != 2 {
+		t.Fatalf("Expected max_clicks 2, got %v", resp.MaxClicks)
+	}
+
+	record, err := app.getURL(context.Background(), resp.ShortCode)
+	if err != nil {
+		t.Fatalf("Failed to get URL: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := app.trackClick(context.Background(), &Click{URLID: record.ID, UserAgent: "Test-Agent"}); err != nil {
+			t.Fatalf("Failed to track click %d: %v", i+1, err)
+		}
+	}
+
+	if err := app.trackClick(context.Background(), &Click{URLID: record.ID, UserAgent: "Test-Agent"}); !errors.Is(err, ErrClickLimitReached) {
+		t.Errorf("Expected ErrClickLimitReached, got: %v", err)
+	}
+
+	updatedRecord, err := app.getURL(context.Background(), resp.ShortCode)
+	if err != nil {
+		t.Fatalf("Failed to get updated URL: %v", err)
+	}
+
+	if updatedRecord.Clicks != 2 || !updatedRecord.IsExhausted() {
+		t.Errorf("Expected 2 clicks and exhausted link, got %d clicks", updatedRecord.Clicks)
+	}
+}
+
+func TestTrackClick_ClickLimitConcurrent(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	resp, err := app.createShortURL(context.Background(), &ShortenRequest{URL: "https://www.example.com/limit-concurrent", MaxClicks: 5})
+	if err != nil {
+		t.Fatalf("Failed to create short URL: %v", err)
+	}
+
+	record, err := app.getURL(context.Background(), resp.ShortCode)
+	if err != nil {
+		t.Fatalf("Failed to get URL: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	var claimed atomic.Int64
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if app.trackClick(context.Background(), &Click{URLID: record.ID, UserAgent: "Test-Agent"}) == nil {
+				claimed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if claimed.Load() > 5 {
+		t.Errorf("Expected at most 5 claimed clicks, got %d", claimed.Load())
+	}
+
+	updatedRecord, err := app.getURL(context.Background(), resp.ShortCode)
+	if err != nil {
+		t.Fatalf("Failed to get updated URL: %v", err)
+	}
+
+	if updatedRecord.Clicks != claimed.Load() {
+		t.Errorf("Expected %d recorded clicks, got %d", claimed.Load(), updatedRecord.Clicks)
+	}
+}
+
+func TestCreateShortURL_Password(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	url := "https://www.example.com/password-test"
+	resp, err := app.createShortURL(context.Background(), &ShortenRequest{URL: url, Password: "hunter2"})
+	if err != nil {
+		t.Fatalf("Failed to create protected URL: %v", err)
+	}
+
+	if !resp.PasswordProtected {
+		t.Error("Expected password_protected to be set")
+	}
+
+	record, err := app.getURL(context.Background(), resp.ShortCode)
+	if err != nil {
+		t.Fatalf("Failed to get URL: %v", err)
+	}
+
+	if record.PasswordHash == "" || record.PasswordHash == "hunter2" {
+		t.Errorf("Expected a password hash to be stored, got '%s'", record.PasswordHash)
+	}
+
+	if !record.checkPassword("hunter2") || record.checkPassword("wrong") {
+		t.Error("Expected password check to accept only the correct password")
+	}
+
+	stats, err := app.getStats(context.Background(), resp.ShortCode)
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+
+	if !stats.PasswordProtected || stats.OriginalURL != "" {
+		t.Errorf("Expected protected stats without original URL, got '%s'", stats.OriginalURL)
+	}
+
+	// Protected links are not reused for plain shortening
+	plain, err := app.createShortURL(context.Background(), &ShortenRequest{URL: url})
+	if err != nil {
+		t.Fatalf("Failed to create plain URL: %v", err)
+	}
+
+	if plain.ShortCode == resp.ShortCode || plain.PasswordProtected {
+		t.Error("Expected plain shortening to get its own unprotected code")
+	}
+}
+
+func TestUpdateURL(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	oldURL := "https://www.example.com/old-doc"
+	newURL := "https://www.example.com/new-doc"
+	resp, err := app.createShortURL(context.Background(), &ShortenRequest{URL: oldURL})
+	if err != nil {
+		t.Fatalf("Failed to create short URL: %v", err)
+	}
+
+	record, err := app.updateURL(context.Background(), resp.ShortCode, &UpdateRequest{URL: newURL, Actor: "alice"})
+	if err != nil {
+		t.Fatalf("Failed to update URL: %v", err)
+	}
+
+	if record.OriginalURL != newURL {
+		t.Errorf("Expected original URL '%s', got '%s'", newURL, record.OriginalURL)
+	}
+
+	// Updating to the same destination records nothing
+	if _, err := app.updateURL(context.Background(), resp.ShortCode, &UpdateRequest{URL: newURL, Actor: "bob"}); err != nil {
+		t.Fatalf("Failed to repeat update: %v", err)
+	}
+
+	history, err := app.getHistory(context.Background(), resp.ShortCode)
+	if err != nil {
+		t.Fatalf("Failed to get history: %v", err)
+	}
+
+	if len(history.Revisions) != 1 {
+		t.Fatalf("Expected 1 revision, got %d", len(history.Revisions))
+	}
+
+	rev := history.Revisions[0]
+	if rev.PreviousURL != oldURL || rev.NewURL != newURL || rev.Actor != "alice" || rev.ChangedAt.IsZero() {
+		t.Errorf("Unexpected revision: %+v", rev)
+	}
+
+	// Retargeted links are not reused for plain shortening
+	plain, err := app.createShortURL(context.Background(), &ShortenRequest{URL: newURL})
+	if err != nil {
+		t.Fatalf("Failed to create plain URL: %v", err)
+	}
+
+	if plain.ShortCode == resp.ShortCode {
+		t.Error("Expected plain shortening to get its own code")
+	}
+}
+
+func TestUpdateURL_Errors(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	if _, err := app.updateURL(context.Background(), "nonexistent", &UpdateRequest{URL: "https://www.example.com"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got: %v", err)
+	}
+
+	resp, err := app.createShortURL(context.Background(), &ShortenRequest{URL: "https://www.example.com/update-invalid"})
+	if err != nil {
+		t.Fatalf("Failed to create short URL: %v", err)
+	}
+
+	if _, err := app.updateURL(context.Background(), resp.ShortCode, &UpdateRequest{URL: "ftp://example.com"}); err == nil {
+		t.Error("Expected error for invalid URL, got nil")
+	}
+}
+
+func TestDeleteURL(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	resp, err := app.createShortURL(context.Background(), &ShortenRequest{URL: "https://www.example.com/delete-test"})
+	if err != nil {
+		t.Fatalf("Failed to create short URL: %v", err)
+	}
+
+	record, err := app.getURL(context.Background(), resp.ShortCode)
+	if err != nil {
+		t.Fatalf("Failed to get URL: %v", err)
+	}
+
+	if err := app.trackClick(context.Background(), &Click{URLID: record.ID, UserAgent: "Test-Agent"}); err != nil {
+		t.Fatalf("Failed to track click: %v", err)
+	}
+
+	if err := app.deleteURL(context.Background(), resp.ShortCode); err != nil {
+		t.Fatalf("Failed to delete URL: %v", err)
+	}
+
+	if _, err := app.getURL(context.Background(), resp.ShortCode); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after delete, got: %v", err)
+	}
+
+	var clicks int
+	if err := testDB(app).QueryRow("SELECT COUNT(*) FROM clicks WHERE url_id = ?", record.ID).Scan(&clicks); err != nil {
+		t.Fatalf("Failed to count clicks: %v", err)
+	}
+
+	if clicks != 0 {
+		t.Errorf("Expected clicks to be deleted, got %d", clicks)
+	}
+
+	if err := app.deleteURL(context.Background(), resp.ShortCode); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for second delete, got: %v", err)
+	}
+}
+
+func TestSetDisabled(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	url := "https://www.example.com/disable-test"
+	resp, err := app.createShortURL(context.Background(), &ShortenRequest{URL: url})
+	if err != nil {
+		t.Fatalf("Failed to create short URL: %v", err)
+	}
+
+	if err := app.setDisabled(context.Background(), resp.ShortCode, true); err != nil {
+		t.Fatalf("Failed to disable URL: %v", err)
+	}
+
+	record, err := app.getURL(context.Background(), resp.ShortCode)
+	if err != nil {
+		t.Fatalf("Failed to get URL: %v", err)
+	}
+
+	if !record.Disabled {
+		t.Error("Expected URL to be disabled")
+	}
+
+	// Disabled links are not reused for plain shortening
+	plain, err := app.createShortURL(context.Background(), &ShortenRequest{URL: url})
+	if err != nil {
+		t.Fatalf("Failed to create plain URL: %v", err)
+	}
+
+	if plain.ShortCode == resp.ShortCode {
+		t.Error("Expected plain shortening to get its own code")
+	}
+
+	if err := app.setDisabled(context.Background(), resp.ShortCode, false); err != nil {
+		t.Fatalf("Failed to enable URL: %v", err)
+	}
+
+	stats, err := app.getStats(context.Background(), resp.ShortCode)
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+
+	if stats.Disabled {
+		t.Error("Expected URL to be enabled")
+	}
+
+	if err := app.setDisabled(context.Background(), "nonexistent", true); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got: %v", err)
+	}
+}
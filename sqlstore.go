@@ -0,0 +1,750 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	// clickInsertChunk bounds the rows per INSERT to stay under SQLite's variable limit
+	clickInsertChunk = 100
+	clickColumns     = 6
+
+	// createURLAttempts bounds the retries of inserts that lost a race for their ID
+	createURLAttempts = 5
+)
+
+// sqlStore is the Store of SQL databases. Queries are written for SQLite and
+// adapted to other databases by the dialect.
+type sqlStore struct {
+	db      *sql.DB
+	dialect *sqlDialect
+}
+
+// openSQLStore connects to a database of the given dialect
+func openSQLStore(ctx context.Context, dialect *sqlDialect, databaseURL string) (*sqlStore, error) {
+	db, err := sql.Open(dialect.driver, databaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify database connection
+	if err := db.PingContext(ctx); err != nil {
+		return nil, errors.Join(err, db.Close())
+	}
+
+	return &sqlStore{db: db, dialect: dialect}, nil
+}
+
+// nullableInt converts an optional positive limit to a value for an INTEGER column
+func nullableInt(n int64) any {
+	if n == 0 {
+		return nil
+	}
+	return n
+}
+
+// nullableString converts an optional string to a value for a TEXT column
+func nullableString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// isUniqueViolation reports whether err is a UNIQUE constraint failure
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "23505" // unique_violation
+	}
+	return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
+// CreateURL inserts a URL in a single statement, reserving its ID first to
+// generate the short code. Racing inserts of the same reuse key are resolved
+// by its unique index, the loser returning the winner's URL. Inserts that
+// lose a race for the reserved ID are retried.
+func (s *sqlStore) CreateURL(ctx context.Context, url *NewURL) (*URLRecord, bool, error) {
+	isAlias := url.ShortCode != ""
+	record := &URLRecord{OriginalURL: url.OriginalURL, PasswordHash: url.PasswordHash}
+	if url.ExpiresAt != nil {
+		expiresAt := url.ExpiresAt.UTC().Truncate(time.Second)
+		record.ExpiresAt = &expiresAt
+	}
+	if url.MaxClicks > 0 {
+		maxClicks := url.MaxClicks
+		record.MaxClicks = &maxClicks
+	}
+
+	var err error
+	for range createURLAttempts {
+		record.ShortCode = url.ShortCode
+		if !isAlias {
+			if err = s.db.QueryRowContext(ctx, s.dialect.reserveID).Scan(&record.ID); err != nil {
+				return nil, false, fmt.Errorf("failed to reserve URL ID: %w", err)
+			}
+			// Generate collision-free, non-enumerable short code
+			record.ShortCode = generateShortCode(record.ID)
+		}
+
+		// Aliases let the database assign the ID, so a unique violation can only
+		// come from their short code and never from an ID reserved concurrently
+		columns, values := "id, ", "?, "
+		args := []any{record.ID}
+		if isAlias {
+			columns, values, args = "", "", nil
+		}
+		args = append(args, record.ShortCode, url.OriginalURL, isAlias, s.dialect.nullableTime(url.ExpiresAt),
+			nullableInt(url.MaxClicks), url.PasswordHash, nullableInt(url.APIKeyID), encodeChain(url.RedirectChain),
+			nullableString(url.ReuseKey))
+
+		err = s.db.QueryRowContext(ctx, s.dialect.rebind(`
+			INSERT INTO urls (`+columns+`short_code, original_url, is_alias, expires_at, max_clicks, password_hash,
+				api_key_id, redirect_chain, reuse_key)
+			VALUES (`+values+`?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (reuse_key) DO NOTHING
+			RETURNING id, created_at
+		`), args...).Scan(&record.ID, &record.CreatedAt)
+		switch {
+		case err == nil:
+			return record, true, nil
+		case err == sql.ErrNoRows:
+			// Another URL has the reuse key, unless it was deleted since
+			existing, err := s.findReusableURL(ctx, url.ReuseKey)
+			if err != ErrNotFound {
+				return existing, false, err
+			}
+		case isUniqueViolation(err) && isAlias:
+			return nil, false, fmt.Errorf("%w: %q is already in use", ErrAliasConflict, url.ShortCode)
+		case !isUniqueViolation(err):
+			return nil, false, fmt.Errorf("failed to insert URL: %w", err)
+		}
+	}
+
+	return nil, false, fmt.Errorf("failed to insert URL after %d attempts: %w", createURLAttempts, err)
+}
+
+// findReusableURL returns the URL holding a reuse key
+func (s *sqlStore) findReusableURL(ctx context.Context, reuseKey string) (*URLRecord, error) {
+	var record URLRecord
+	err := s.db.QueryRowContext(ctx, s.dialect.rebind(`
+		SELECT id, short_code, original_url, created_at
+		FROM urls
+		WHERE reuse_key = ?
+	`), reuseKey).Scan(&record.ID, &record.ShortCode, &record.OriginalURL, &record.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	return &record, nil
+}
+
+func (s *sqlStore) GetURL(ctx context.Context, shortCode string) (*URLRecord, error) {
+	var record URLRecord
+
+	err := s.db.QueryRowContext(ctx, s.dialect.rebind(`
+		SELECT id, short_code, original_url, created_at, clicks, last_clicked_at, expires_at, max_clicks,
+			password_hash, disabled, api_key_id
+		FROM urls
+		WHERE short_code = ?
+	`), shortCode).Scan(
+		&record.ID,
+		&record.ShortCode,
+		&record.OriginalURL,
+		&record.CreatedAt,
+		&record.Clicks,
+		&record.LastClickedAt,
+		&record.ExpiresAt,
+		&record.MaxClicks,
+		&record.PasswordHash,
+		&record.Disabled,
+		&record.APIKeyID,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	return &record, nil
+}
+
+func (s *sqlStore) UpdateURL(ctx context.Context, shortCode, destination string, chain []string, actor string) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var id int64
+	var previousURL string
+	err = tx.QueryRowContext(ctx, s.dialect.rebind("SELECT id, original_url FROM urls WHERE short_code = ?"), shortCode).Scan(&id, &previousURL)
+	if err == sql.ErrNoRows {
+		return false, ErrNotFound
+	}
+	if err != nil {
+		return false, fmt.Errorf("database error: %w", err)
+	}
+
+	if previousURL == destination {
+		return false, nil
+	}
+
+	_, err = tx.ExecContext(ctx, s.dialect.rebind(`
+		INSERT INTO url_revisions (url_id, previous_url, new_url, actor)
+		VALUES (?, ?, ?, ?)
+	`), id, previousURL, destination, actor)
+	if err != nil {
+		return false, fmt.Errorf("failed to insert revision: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		s.dialect.rebind("UPDATE urls SET original_url = ?, redirect_chain = ?, reuse_key = NULL WHERE id = ?"),
+		destination, encodeChain(chain), id,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to update URL: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return true, nil
+}
+
+func (s *sqlStore) SetDisabled(ctx context.Context, shortCode string, disabled bool) error {
+	query := "UPDATE urls SET disabled = ? WHERE short_code = ?"
+	if disabled {
+		query = "UPDATE urls SET disabled = ?, reuse_key = NULL WHERE short_code = ?"
+	}
+	result, err := s.db.ExecContext(ctx, s.dialect.rebind(query), disabled, shortCode)
+	if err != nil {
+		return fmt.Errorf("failed to update URL: %w", err)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check URL update: %w", err)
+	}
+	if updated == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// DeleteURL removes dependent rows explicitly in the same transaction, as
+// SQLite only enforces ON DELETE CASCADE when foreign keys are enabled on the
+// connection
+func (s *sqlStore) DeleteURL(ctx context.Context, shortCode string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRowContext(ctx, s.dialect.rebind("SELECT id FROM urls WHERE short_code = ?"), shortCode).Scan(&id)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	for _, query := range []string{
+		"DELETE FROM clicks WHERE url_id = ?",
+		"DELETE FROM url_revisions WHERE url_id = ?",
+		"DELETE FROM urls WHERE id = ?",
+	} {
+		if _, err := tx.ExecContext(ctx, s.dialect.rebind(query), id); err != nil {
+			return fmt.Errorf("failed to delete URL: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (s *sqlStore) GetRevisions(ctx context.Context, urlID int64) ([]URLRevision, error) {
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(`
+		SELECT previous_url, new_url, changed_at, actor
+		FROM url_revisions
+		WHERE url_id = ?
+		ORDER BY id DESC
+	`), urlID)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	defer rows.Close()
+
+	revisions := []URLRevision{}
+	for rows.Next() {
+		var rev URLRevision
+		if err := rows.Scan(&rev.PreviousURL, &rev.NewURL, &rev.ChangedAt, &rev.Actor); err != nil {
+			return nil, fmt.Errorf("failed to scan revision: %w", err)
+		}
+		revisions = append(revisions, rev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	return revisions, nil
+}
+
+// TrackClick only bumps the counter of a click-limited link while it is below
+// max_clicks, so concurrent callers can never exceed the limit
+func (s *sqlStore) TrackClick(ctx context.Context, click *Click) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := s.dialect.timeArg(time.Now())
+
+	// Update URL statistics, claiming one of the remaining clicks if limited
+	counter, args := "clicks = clicks + 1, last_clicked_at = ?", []any{now, click.URLID}
+	if click.IsBot {
+		counter, args = "bot_clicks = bot_clicks + 1", args[1:]
+	}
+	result, err := tx.ExecContext(ctx, s.dialect.rebind(`
+		UPDATE urls
+		SET `+counter+`
+		WHERE id = ? AND (max_clicks IS NULL OR clicks < max_clicks)
+	`), args...)
+	if err != nil {
+		return fmt.Errorf("failed to update URL statistics: %w", err)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check URL statistics update: %w", err)
+	}
+	if updated == 0 {
+		return ErrClickLimitReached
+	}
+
+	// Insert click record
+	_, err = tx.ExecContext(ctx, s.dialect.rebind(`
+		INSERT INTO clicks (url_id, clicked_at, user_agent, referer, visitor_hash, is_bot)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`), click.URLID, now, click.UserAgent, click.Referer, nullableString(click.VisitorHash), click.IsBot)
+	if err != nil {
+		return fmt.Errorf("failed to insert click record: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// clickCounts are the coalesced counter updates of one URL in a batch
+type clickCounts struct {
+	clicks    int64
+	botClicks int64
+	last      time.Time
+}
+
+// WriteClicks inserts a batch of clicks and applies their counter updates in
+// a single transaction. Clicks on URLs deleted since are dropped, as they
+// would violate the foreign key of databases enforcing it.
+func (s *sqlStore) WriteClicks(ctx context.Context, clicks []*Click) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	exists, err := s.existingURLs(ctx, tx, clicks)
+	if err != nil {
+		return err
+	}
+
+	counts := make(map[int64]*clickCounts)
+	args := make([]any, 0, clickColumns*len(clicks))
+
+	for _, click := range clicks {
+		if !exists[click.URLID] {
+			continue
+		}
+		args = append(args, click.URLID, s.dialect.timeArg(click.Time), click.UserAgent, click.Referer,
+			nullableString(click.VisitorHash), click.IsBot)
+
+		c, ok := counts[click.URLID]
+		if !ok {
+			c = &clickCounts{}
+			counts[click.URLID] = c
+		}
+		if click.IsBot {
+			c.botClicks++
+		} else {
+			c.clicks++
+			if click.Time.After(c.last) {
+				c.last = click.Time
+			}
+		}
+	}
+
+	written := len(args) / clickColumns
+	for start := 0; start < written; start += clickInsertChunk {
+		end := min(start+clickInsertChunk, written)
+		rows := strings.TrimSuffix(strings.Repeat("(?, ?, ?, ?, ?, ?), ", end-start), ", ")
+
+		_, err := tx.ExecContext(ctx,
+			s.dialect.rebind("INSERT INTO clicks (url_id, clicked_at, user_agent, referer, visitor_hash, is_bot) VALUES "+rows),
+			args[start*clickColumns:end*clickColumns]...,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert click records: %w", err)
+		}
+	}
+
+	for urlID, c := range counts {
+		if c.clicks > 0 {
+			_, err := tx.ExecContext(ctx, s.dialect.rebind(`
+				UPDATE urls
+				SET clicks = clicks + ?,
+					last_clicked_at = `+s.dialect.latestClick+`
+				WHERE id = ?
+			`), c.clicks, s.dialect.timeArg(c.last), urlID)
+			if err != nil {
+				return fmt.Errorf("failed to update URL statistics: %w", err)
+			}
+		}
+
+		if c.botClicks > 0 {
+			_, err := tx.ExecContext(ctx, s.dialect.rebind("UPDATE urls SET bot_clicks = bot_clicks + ? WHERE id = ?"), c.botClicks, urlID)
+			if err != nil {
+				return fmt.Errorf("failed to update URL statistics: %w", err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// existingURLs reports which of the URLs clicked still exist
+func (s *sqlStore) existingURLs(ctx context.Context, tx *sql.Tx, clicks []*Click) (map[int64]bool, error) {
+	exists := make(map[int64]bool)
+	var ids []any
+	for _, click := range clicks {
+		if _, ok := exists[click.URLID]; !ok {
+			exists[click.URLID] = false
+			ids = append(ids, click.URLID)
+		}
+	}
+
+	for start := 0; start < len(ids); start += clickInsertChunk {
+		end := min(start+clickInsertChunk, len(ids))
+		params := strings.TrimSuffix(strings.Repeat("?, ", end-start), ", ")
+
+		rows, err := tx.QueryContext(ctx, s.dialect.rebind("SELECT id FROM urls WHERE id IN ("+params+")"), ids[start:end]...)
+		if err != nil {
+			return nil, fmt.Errorf("database error: %w", err)
+		}
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan URL ID: %w", err)
+			}
+			exists[id] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("database error: %w", err)
+		}
+	}
+
+	return exists, nil
+}
+
+func (s *sqlStore) GetStats(ctx context.Context, shortCode string) (*URLStats, error) {
+	var stats URLStats
+	var chain string
+
+	err := s.db.QueryRowContext(ctx, s.dialect.rebind(`
+		SELECT short_code, original_url, created_at, clicks, bot_clicks, last_clicked_at, expires_at, max_clicks,
+			password_hash <> '', disabled, redirect_chain
+		FROM urls
+		WHERE short_code = ?
+	`), shortCode).Scan(
+		&stats.ShortCode,
+		&stats.OriginalURL,
+		&stats.CreatedAt,
+		&stats.TotalClicks,
+		&stats.BotClicks,
+		&stats.LastClickedAt,
+		&stats.ExpiresAt,
+		&stats.MaxClicks,
+		&stats.PasswordProtected,
+		&stats.Disabled,
+		&chain,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	stats.RedirectChain, err = decodeChain(chain)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
+func (s *sqlStore) CountClicks(ctx context.Context, urlID int64, interval string, from, to time.Time, includeBots bool) (map[time.Time]int64, error) {
+	bucket, ok := s.dialect.buckets[interval]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown interval %q", ErrInvalidTimeSeries, interval)
+	}
+
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(`
+		SELECT `+bucket+` AS bucket, COUNT(*)
+		FROM clicks
+		WHERE url_id = ? AND clicked_at >= ? AND clicked_at < ? AND (NOT is_bot OR ?)
+		GROUP BY bucket
+	`), urlID, s.dialect.timeArg(from), s.dialect.timeArg(to), includeBots)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[time.Time]int64)
+	for rows.Next() {
+		var bucket string
+		var clicks int64
+		if err := rows.Scan(&bucket, &clicks); err != nil {
+			return nil, fmt.Errorf("failed to scan click count: %w", err)
+		}
+
+		start, err := time.Parse(dbTimeFormat, bucket)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bucket %q: %w", bucket, err)
+		}
+		counts[start] = clicks
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	return counts, nil
+}
+
+func (s *sqlStore) ClickSources(ctx context.Context, urlID int64, from, to *time.Time, includeBots bool) ([]ClickSource, error) {
+	query := `
+		SELECT COALESCE(user_agent, ''), COALESCE(referer, ''), COUNT(*)
+		FROM clicks
+		WHERE url_id = ? AND (NOT is_bot OR ?)`
+	args := []any{urlID, includeBots}
+	if from != nil {
+		query += " AND clicked_at >= ?"
+		args = append(args, s.dialect.timeArg(*from))
+	}
+	if to != nil {
+		query += " AND clicked_at < ?"
+		args = append(args, s.dialect.timeArg(*to))
+	}
+	query += " GROUP BY 1, 2"
+
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	defer rows.Close()
+
+	var sources []ClickSource
+	for rows.Next() {
+		var source ClickSource
+		if err := rows.Scan(&source.UserAgent, &source.Referer, &source.Clicks); err != nil {
+			return nil, fmt.Errorf("failed to scan click count: %w", err)
+		}
+		sources = append(sources, source)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	return sources, nil
+}
+
+func (s *sqlStore) UniqueVisitors(ctx context.Context, shortCode string, since time.Time) ([]DailyVisitors, error) {
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(`
+		SELECT `+s.dialect.clickDay+` AS day, COUNT(DISTINCT clicks.visitor_hash)
+		FROM clicks
+		JOIN urls ON urls.id = clicks.url_id
+		WHERE urls.short_code = ? AND clicks.visitor_hash IS NOT NULL AND NOT clicks.is_bot
+			AND clicks.clicked_at >= ?
+		GROUP BY day
+		ORDER BY day
+	`), shortCode, s.dialect.timeArg(since))
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	defer rows.Close()
+
+	visitors := []DailyVisitors{}
+	for rows.Next() {
+		var day DailyVisitors
+		if err := rows.Scan(&day.Date, &day.Visitors); err != nil {
+			return nil, fmt.Errorf("failed to scan visitor count: %w", err)
+		}
+		visitors = append(visitors, day)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	return visitors, nil
+}
+
+// VisitorSalt shares salts between replicas through the visitor_salts table
+func (s *sqlStore) VisitorSalt(ctx context.Context, day string, salt []byte) ([]byte, error) {
+	// Another replica may have created the day's salt first, in which case we
+	// use theirs, or moved on to a later day, in which case there is none
+	_, err := s.db.ExecContext(ctx, s.dialect.rebind(`
+		INSERT INTO visitor_salts (day, salt)
+		SELECT ?, ? WHERE NOT EXISTS (SELECT 1 FROM visitor_salts WHERE day > ?)
+		ON CONFLICT (day) DO NOTHING
+	`), day, hex.EncodeToString(salt), day)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store visitor salt: %w", err)
+	}
+
+	var stored string
+	err = s.db.QueryRowContext(ctx, s.dialect.rebind("SELECT salt FROM visitor_salts WHERE day = ?"), day).Scan(&stored)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %s", ErrPastVisitorSalt, day)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load visitor salt: %w", err)
+	}
+	if salt, err = hex.DecodeString(stored); err != nil {
+		return nil, fmt.Errorf("invalid visitor salt: %w", err)
+	}
+
+	if _, err := s.db.ExecContext(ctx, s.dialect.rebind("DELETE FROM visitor_salts WHERE day < ?"), day); err != nil {
+		return nil, fmt.Errorf("failed to delete old visitor salts: %w", err)
+	}
+
+	return salt, nil
+}
+
+func (s *sqlStore) CreateAPIKey(ctx context.Context, name, keyHash string) error {
+	_, err := s.db.ExecContext(ctx, s.dialect.rebind("INSERT INTO api_keys (name, key_hash) VALUES (?, ?)"), name, keyHash)
+	if isUniqueViolation(err) {
+		return ErrAPIKeyExists
+	}
+	if err != nil {
+		return fmt.Errorf("failed to insert API key: %w", err)
+	}
+
+	return nil
+}
+
+func (s *sqlStore) RevokeAPIKey(ctx context.Context, name string, at time.Time) (bool, error) {
+	result, err := s.db.ExecContext(ctx,
+		s.dialect.rebind("UPDATE api_keys SET revoked_at = ? WHERE name = ? AND revoked_at IS NULL"),
+		s.dialect.timeArg(at), name,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke API key: %w", err)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to check API key update: %w", err)
+	}
+
+	return updated > 0, nil
+}
+
+func (s *sqlStore) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, name, created_at, revoked_at FROM api_keys ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []APIKey
+	for rows.Next() {
+		var key APIKey
+		if err := rows.Scan(&key.ID, &key.Name, &key.CreatedAt, &key.RevokedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan API key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	return keys, nil
+}
+
+func (s *sqlStore) LookupAPIKey(ctx context.Context, keyHash string) (*APIKey, error) {
+	var apiKey APIKey
+	err := s.db.QueryRowContext(ctx, s.dialect.rebind(`
+		SELECT id, name, created_at
+		FROM api_keys
+		WHERE key_hash = ? AND revoked_at IS NULL
+	`), keyHash).Scan(&apiKey.ID, &apiKey.Name, &apiKey.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	return &apiKey, nil
+}
+
+func (s *sqlStore) Migrate(ctx context.Context) error {
+	_, err := newMigrator(s.db, s.dialect, s.dialect.migrations).Up(ctx)
+	return err
+}
+
+func (s *sqlStore) SchemaVersion(ctx context.Context) (int, error) {
+	var version int
+	err := s.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+func (s *sqlStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
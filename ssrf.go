@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PolicyPrivateDestination is the error code for URLs pointing into private networks
+const PolicyPrivateDestination = "private_destination"
+
+// destinationLookupTimeout bounds DNS lookups made while validating a URL
+const destinationLookupTimeout = 2 * time.Second
+
+// ipResolver is the subset of net.Resolver used to resolve destination hosts
+type ipResolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// destinationGuard rejects URLs whose host is, or resolves to, a loopback,
+// link-local, private (RFC 1918 / IPv6 ULA) or unspecified address, so the
+// shortener can't be used as an open redirector into internal networks.
+type destinationGuard struct {
+	resolver          ipResolver
+	allowed           []*net.IPNet
+	allowUnresolvable bool
+}
+
+// isPrivateIP reports whether ip is not publicly routable
+func isPrivateIP(ip net.IP) bool {
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+		// 0.0.0.0/8 is "this network" and reaches the local host on most systems
+		if ip[0] == 0 {
+			return true
+		}
+	}
+
+	return ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsUnspecified()
+}
+
+// parseLooseIPv4 parses the IPv4 forms accepted by inet_aton, which browsers
+// and resolvers also honour: 2130706433, 0x7f000001, 017700000001, 127.1 and
+// dotted parts in octal or hex such as 0177.0.0.1.
+func parseLooseIPv4(host string) net.IP {
+	parts := strings.Split(host, ".")
+	if len(parts) > 4 {
+		return nil
+	}
+
+	values := make([]uint64, len(parts))
+	for i, part := range parts {
+		base := 10
+		switch {
+		case strings.HasPrefix(part, "0x") || strings.HasPrefix(part, "0X"):
+			part, base = part[2:], 16
+		case len(part) > 1 && part[0] == '0':
+			part, base = part[1:], 8
+		}
+
+		value, err := strconv.ParseUint(part, base, 32)
+		if err != nil {
+			return nil
+		}
+		values[i] = value
+	}
+
+	// All but the last part are single bytes; the last fills the remaining bytes
+	var addr uint64
+	for _, value := range values[:len(values)-1] {
+		if value > 0xff {
+			return nil
+		}
+		addr = addr<<8 | value
+	}
+
+	last := values[len(values)-1]
+	remaining := uint(4 - len(values) + 1)
+	if last >= 1<<(8*remaining) {
+		return nil
+	}
+	addr = addr<<(8*remaining) | last
+
+	return net.IPv4(byte(addr>>24), byte(addr>>16), byte(addr>>8), byte(addr))
+}
+
+// isAllowed reports whether ip falls in a network explicitly allowed by config
+func (g *destinationGuard) isAllowed(ip net.IP) bool {
+	for _, ipNet := range g.allowed {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check rejects u if its host is a private address or resolves to one.
+// Hosts that fail to resolve are rejected too, since we can't tell where they
+// point, unless the guard was configured to allow them.
+func (g *destinationGuard) Check(ctx context.Context, u *url.URL) error {
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return g.reject(host)
+	}
+
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		ips[0] = parseLooseIPv4(host)
+	}
+
+	if ips[0] == nil {
+		// A client hanging up must not cut the lookup short and get the host rejected
+		lookupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), destinationLookupTimeout)
+		defer cancel()
+
+		addrs, err := g.resolver.LookupIPAddr(lookupCtx, host)
+		if err != nil {
+			loggerFromContext(ctx).Warn("Failed to resolve destination host", "host", host, "error", err)
+			if g.allowUnresolvable {
+				return nil
+			}
+			return fmt.Errorf("URL host %q could not be resolved", host)
+		}
+
+		ips = ips[:0]
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+	}
+
+	for _, ip := range ips {
+		if isPrivateIP(ip) && !g.isAllowed(ip) {
+			return g.reject(host)
+		}
+	}
+
+	return nil
+}
+
+func (g *destinationGuard) reject(host string) error {
+	return &PolicyError{
+		Code:   PolicyPrivateDestination,
+		Reason: fmt.Sprintf("URL host %q points to a private or local network", host),
+	}
+}
+
+// WithResolver sets the resolver used to check where destination hosts point
+func WithResolver(resolver ipResolver) AppOption {
+	return func(a *App) error {
+		if resolver == nil {
+			return fmt.Errorf("resolver cannot be nil")
+		}
+		if a.destinations != nil {
+			a.destinations.resolver = resolver
+		}
+		return nil
+	}
+}
+
+// checkDestination validates that rawURL doesn't point into a private network,
+// unless Config.AllowPrivateDestinations is set
+func (a *App) checkDestination(ctx context.Context, rawURL string) error {
+	if a.destinations == nil {
+		return nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL format: %w", err)
+	}
+
+	return a.destinations.Check(ctx, u)
+}
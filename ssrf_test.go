@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// fakeResolver resolves hosts from a fixed table
+type fakeResolver map[string][]string
+
+func (f fakeResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	ips, ok := f[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+
+	var addrs []net.IPAddr
+	for _, ip := range ips {
+		addrs = append(addrs, net.IPAddr{IP: net.ParseIP(ip)})
+	}
+	return addrs, nil
+}
+
+// publicResolver resolves every host to a public address, so tests don't depend on DNS
+type publicResolver struct{}
+
+func (publicResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	return []net.IPAddr{{IP: net.ParseIP("93.184.216.34")}}, nil
+}
+
+func TestParseLooseIPv4(t *testing.T) {
+	testCases := []struct {
+		host     string
+		expected string
+	}{
+		{"2130706433", "127.0.0.1"},
+		{"0x7f000001", "127.0.0.1"},
+		{"017700000001", "127.0.0.1"},
+		{"127.1", "127.0.0.1"},
+		{"0177.0.0.1", "127.0.0.1"},
+		{"10.0x10.1", "10.16.0.1"},
+		{"169.254.169.254", "169.254.169.254"},
+		{"example.com", ""},
+		{"1.2.3.4.5", ""},
+		{"256.0.0.1", ""},
+		{"4294967296", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.host, func(t *testing.T) {
+			ip := parseLooseIPv4(tc.host)
+			switch {
+			case tc.expected == "" && ip != nil:
+				t.Errorf("Expected '%s' not to parse, got %s", tc.host, ip)
+			case tc.expected != "" && !ip.Equal(net.ParseIP(tc.expected)):
+				t.Errorf("Expected '%s' to parse as %s, got %s", tc.host, tc.expected, ip)
+			}
+		})
+	}
+}
+
+func TestDestinationGuard_Check(t *testing.T) {
+	allowed, err := parseNetworks([]string{"10.1.0.0/16"})
+	if err != nil {
+		t.Fatalf("Failed to parse networks: %v", err)
+	}
+
+	guard := &destinationGuard{
+		resolver: fakeResolver{
+			"example.com":       {"93.184.216.34"},
+			"internal.example":  {"93.184.216.34", "192.168.0.10"},
+			"wiki.corp.example": {"10.1.2.3"},
+			"metadata.example":  {"fd00::1"},
+		},
+		allowed: allowed,
+	}
+
+	testCases := []struct {
+		url     string
+		blocked bool
+		name    string
+	}{
+		{"https://example.com/", false, "public host"},
+		{"http://127.0.0.1/", true, "loopback"},
+		{"http://localhost:8080/", true, "localhost"},
+		{"http://app.localhost/", true, "localhost subdomain"},
+		{"http://169.254.169.254/latest/meta-data/", true, "link-local metadata"},
+		{"http://10.0.0.1/", true, "RFC 1918"},
+		{"http://[::1]/", true, "IPv6 loopback"},
+		{"http://[fd12:3456::1]/", true, "IPv6 ULA"},
+		{"http://[::ffff:127.0.0.1]/", true, "IPv4-mapped loopback"},
+		{"http://0.0.0.0/", true, "unspecified"},
+		{"http://2130706433/", true, "decimal IP"},
+		{"http://0x7f.1/", true, "hex IP"},
+		{"https://internal.example/", true, "resolves to private"},
+		{"https://metadata.example/", true, "resolves to ULA"},
+		{"http://10.1.4.5/", false, "allowed network"},
+		{"https://wiki.corp.example/", false, "resolves to allowed network"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			u, _ := url.Parse(tc.url)
+			err := guard.Check(context.Background(), u)
+
+			var policyErr *PolicyError
+			switch {
+			case !tc.blocked && err != nil:
+				t.Errorf("Expected '%s' to be allowed, got: %v", tc.url, err)
+			case tc.blocked && (!errors.As(err, &policyErr) || policyErr.Code != PolicyPrivateDestination):
+				t.Errorf("Expected '%s' to be rejected as private, got: %v", tc.url, err)
+			}
+		})
+	}
+}
+
+func TestDestinationGuard_Unresolvable(t *testing.T) {
+	u, _ := url.Parse("https://unresolvable.example/")
+
+	guard := &destinationGuard{resolver: fakeResolver{}}
+	err := guard.Check(context.Background(), u)
+
+	var policyErr *PolicyError
+	if err == nil || errors.As(err, &policyErr) {
+		t.Errorf("Expected unresolvable host to be rejected, got: %v", err)
+	}
+
+	guard.allowUnresolvable = true
+	if err := guard.Check(context.Background(), u); err != nil {
+		t.Errorf("Expected unresolvable host to be allowed when configured, got: %v", err)
+	}
+}
+
+func TestCreateShortURL_UnresolvableDestination(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	app.destinations.resolver = fakeResolver{}
+
+	req := httptest.NewRequest("POST", "/s", strings.NewReader(`{"url":"https://unresolvable.example/"}`))
+	rec := httptest.NewRecorder()
+	app.handleShorten(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestCreateShortURL_PrivateDestination(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	req := httptest.NewRequest("POST", "/s", strings.NewReader(`{"url":"http://169.254.169.254/latest/meta-data/"}`))
+	rec := httptest.NewRecorder()
+	app.handleShorten(rec, req)
+
+	var errResp ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&errResp); err != nil {
+		t.Fatalf("Failed to decode error response: %v", err)
+	}
+
+	if rec.Code != http.StatusForbidden || errResp.Code != PolicyPrivateDestination {
+		t.Errorf("Expected status %d with code %s, got %d with '%s'", http.StatusForbidden, PolicyPrivateDestination, rec.Code, errResp.Code)
+	}
+}
+
+func TestCreateShortURL_AllowPrivateDestinations(t *testing.T) {
+	cfg := &Config{
+		DatabaseURL:              "file::memory:?cache=shared",
+		Port:                     "7000",
+		BaseURL:                  "http://localhost:7000",
+		AllowPrivateDestinations: true,
+	}
+
+	app, err := NewApp(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Failed to create app: %v", err)
+	}
+	defer app.store.Close()
+
+	if _, err := app.createShortURL(context.Background(), &ShortenRequest{URL: "http://10.0.0.1/wiki"}); err != nil {
+		t.Errorf("Expected private destination to be allowed, got: %v", err)
+	}
+}
+
+func TestNewApp_InvalidAllowedPrivateNetworks(t *testing.T) {
+	cfg := &Config{
+		DatabaseURL:            "file::memory:?cache=shared",
+		AllowedPrivateNetworks: []string{"not-a-network"},
+	}
+
+	if _, err := NewApp(context.Background(), cfg); err == nil {
+		t.Error("Expected error for invalid allowed private networks, got nil")
+	}
+}
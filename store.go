@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrAPIKeyExists is returned when creating an API key with a name that is taken
+var ErrAPIKeyExists = errors.New("API key already exists")
+
+// Store persists shortened URLs, their clicks and API keys. Validation,
+// policy checks and caching are left to App, so a backend only stores and
+// queries data. Methods report unknown short codes with ErrNotFound.
+type Store interface {
+	// CreateURL stores a new URL, generating its short code from its ID unless
+	// it has an alias. Aliases that are already in use fail with ErrAliasConflict.
+	// If a URL with the same ReuseKey exists it is returned instead, reporting
+	// false. Creation is atomic, so concurrent calls share a single URL.
+	CreateURL(ctx context.Context, url *NewURL) (*URLRecord, bool, error)
+	GetURL(ctx context.Context, shortCode string) (*URLRecord, error)
+	// UpdateURL points a short code at a new destination, recording a revision
+	// by actor and clearing its reuse key. It reports false without changing
+	// anything if the destination is the same.
+	UpdateURL(ctx context.Context, shortCode, destination string, chain []string, actor string) (bool, error)
+	// SetDisabled disables or re-enables a URL. Disabling clears its reuse key
+	// for good.
+	SetDisabled(ctx context.Context, shortCode string, disabled bool) error
+	// DeleteURL removes a URL along with its clicks and revisions
+	DeleteURL(ctx context.Context, shortCode string) error
+	// GetRevisions returns the revisions of a URL, newest first
+	GetRevisions(ctx context.Context, urlID int64) ([]URLRevision, error)
+
+	// TrackClick records one click and bumps the link's counters, failing with
+	// ErrClickLimitReached once a click-limited link is used up
+	TrackClick(ctx context.Context, click *Click) error
+	// WriteClicks records a batch of clicks without enforcing click limits
+	WriteClicks(ctx context.Context, clicks []*Click) error
+	// GetStats returns the stored statistics of a short code, without
+	// UniqueVisitors
+	GetStats(ctx context.Context, shortCode string) (*URLStats, error)
+	// CountClicks counts the clicks on a URL from from (inclusive) to to
+	// (exclusive) per timeSeriesIntervals bucket, keyed by bucket start
+	CountClicks(ctx context.Context, urlID int64, interval string, from, to time.Time, includeBots bool) (map[time.Time]int64, error)
+	// ClickSources counts the clicks on a URL per user agent and referrer,
+	// optionally limited to from (inclusive) and to (exclusive)
+	ClickSources(ctx context.Context, urlID int64, from, to *time.Time, includeBots bool) ([]ClickSource, error)
+	// UniqueVisitors counts distinct human visitors to a short code per UTC day
+	// since the given time, oldest first, skipping days without clicks
+	UniqueVisitors(ctx context.Context, shortCode string, since time.Time) ([]DailyVisitors, error)
+	// VisitorSalt stores salt as the salt of day unless one exists already and
+	// returns the stored one. Salts of earlier days are deleted, and asking for
+	// one fails with ErrPastVisitorSalt rather than creating it again.
+	VisitorSalt(ctx context.Context, day string, salt []byte) ([]byte, error)
+
+	CreateAPIKey(ctx context.Context, name, keyHash string) error
+	// RevokeAPIKey revokes the active key named name, reporting false if there is none
+	RevokeAPIKey(ctx context.Context, name string, at time.Time) (bool, error)
+	ListAPIKeys(ctx context.Context) ([]APIKey, error)
+	// LookupAPIKey finds an active key by hash, failing with ErrInvalidAPIKey
+	LookupAPIKey(ctx context.Context, keyHash string) (*APIKey, error)
+
+	// Migrate brings the schema up to date
+	Migrate(ctx context.Context) error
+	// SchemaVersion returns the latest migration applied to the schema
+	SchemaVersion(ctx context.Context) (int, error)
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// NewURL is a URL to be stored by Store.CreateURL
+type NewURL struct {
+	// ShortCode is the alias, or empty to generate one
+	ShortCode     string
+	OriginalURL   string
+	ExpiresAt     *time.Time
+	MaxClicks     int64
+	PasswordHash  string
+	APIKeyID      int64
+	RedirectChain []string
+	// ReuseKey marks a plain link that requests for the same destination
+	// share, or is empty
+	ReuseKey string
+}
+
+// ClickSource is the number of clicks sharing a user agent and referrer
+type ClickSource struct {
+	UserAgent string
+	Referer   string
+	Clicks    int64
+}
+
+// openStore opens the backend selected by the scheme of databaseURL:
+// memory:// keeps everything in process memory, postgres:// connects to
+// PostgreSQL and anything else is a libsql/SQLite URL
+func openStore(ctx context.Context, databaseURL string) (Store, error) {
+	scheme, _, _ := strings.Cut(databaseURL, ":")
+
+	dialect := sqliteDialect
+	switch strings.ToLower(scheme) {
+	case "memory":
+		return newMemoryStore(), nil
+	case "postgres", "postgresql":
+		dialect = postgresDialect
+		fallthrough
+	default:
+		store, err := openSQLStore(ctx, dialect, databaseURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open database: %w", err)
+		}
+		return store, nil
+	}
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testStores returns a new empty store of every backend
+func testStores(t *testing.T) map[string]Store {
+	t.Helper()
+
+	sqlite, err := openStore(context.Background(), "file:"+strings.ReplaceAll(t.Name(), "/", "_")+"?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatalf("Failed to open SQL store: %v", err)
+	}
+	memory, err := openStore(context.Background(), "memory://")
+	if err != nil {
+		t.Fatalf("Failed to open memory store: %v", err)
+	}
+
+	stores := map[string]Store{"sqlite": sqlite, "memory": memory}
+	if postgres := openPostgresTestStore(t); postgres != nil {
+		stores["postgres"] = postgres
+	}
+	for _, store := range stores {
+		if err := store.Migrate(context.Background()); err != nil {
+			t.Fatalf("Failed to migrate store: %v", err)
+		}
+		t.Cleanup(func() { store.Close() })
+	}
+
+	return stores
+}
+
+// openPostgresTestStore opens a store in a new schema of the PostgreSQL
+// database at UL_TEST_POSTGRES_URL, or returns nil when it is not set
+func openPostgresTestStore(t *testing.T) Store {
+	t.Helper()
+
+	databaseURL := os.Getenv("UL_TEST_POSTGRES_URL")
+	if databaseURL == "" {
+		return nil
+	}
+
+	admin, err := sql.Open("pgx", databaseURL)
+	if err != nil {
+		t.Fatalf("Failed to open PostgreSQL: %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schema := "ul_test_" + strings.ToLower(regexp.MustCompile(`\W`).ReplaceAllString(t.Name(), "_"))
+	if _, err := admin.Exec("DROP SCHEMA IF EXISTS " + schema + " CASCADE; CREATE SCHEMA " + schema); err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+	t.Cleanup(func() { admin.Exec("DROP SCHEMA " + schema + " CASCADE") })
+
+	u, err := url.Parse(databaseURL)
+	if err != nil {
+		t.Fatalf("Invalid UL_TEST_POSTGRES_URL: %v", err)
+	}
+	query := u.Query()
+	query.Set("search_path", schema)
+	u.RawQuery = query.Encode()
+
+	store, err := openStore(context.Background(), u.String())
+	if err != nil {
+		t.Fatalf("Failed to open PostgreSQL store: %v", err)
+	}
+	return store
+}
+
+func TestOpenStore(t *testing.T) {
+	store, err := openStore(context.Background(), "memory://")
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	if _, ok := store.(*memoryStore); !ok {
+		t.Errorf("Expected a memory store, got %T", store)
+	}
+
+	store, err = openStore(context.Background(), "file::memory:?cache=shared")
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	defer store.Close()
+	if _, ok := store.(*sqlStore); !ok {
+		t.Errorf("Expected a SQL store, got %T", store)
+	}
+}
+
+func TestStore_URLs(t *testing.T) {
+	ctx := context.Background()
+
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			plain := &NewURL{OriginalURL: "https://example.com", ReuseKey: "https://example.com"}
+			generated, created, err := store.CreateURL(ctx, plain)
+			if err != nil || !created {
+				t.Fatalf("Failed to create URL: %v", err)
+			}
+			if generated.ShortCode != generateShortCode(generated.ID) || generated.CreatedAt.IsZero() {
+				t.Errorf("Expected a generated short code, got %+v", generated)
+			}
+
+			reused, created, err := store.CreateURL(ctx, plain)
+			if err != nil || created || reused.ShortCode != generated.ShortCode {
+				t.Errorf("Expected %s to be reused, got %+v (created %v): %v", generated.ShortCode, reused, created, err)
+			}
+
+			alias, _, err := store.CreateURL(ctx, &NewURL{ShortCode: "my-alias", OriginalURL: "https://example.org", MaxClicks: 5})
+			if err != nil || alias.ShortCode != "my-alias" || alias.MaxClicks == nil || *alias.MaxClicks != 5 {
+				t.Fatalf("Expected an aliased URL, got %+v: %v", alias, err)
+			}
+			if _, _, err := store.CreateURL(ctx, &NewURL{ShortCode: "my-alias", OriginalURL: "https://example.net"}); !errors.Is(err, ErrAliasConflict) {
+				t.Errorf("Expected ErrAliasConflict, got %v", err)
+			}
+
+			changed, err := store.UpdateURL(ctx, generated.ShortCode, "https://example.com/new", []string{"https://bit.ly/x"}, "ci")
+			if err != nil || !changed {
+				t.Fatalf("Expected the URL to change, got %v: %v", changed, err)
+			}
+			if changed, err := store.UpdateURL(ctx, generated.ShortCode, "https://example.com/new", nil, "ci"); err != nil || changed {
+				t.Errorf("Expected an unchanged URL, got %v: %v", changed, err)
+			}
+			if _, err := store.UpdateURL(ctx, "missing", "https://example.com", nil, ""); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Expected ErrNotFound, got %v", err)
+			}
+
+			revisions, err := store.GetRevisions(ctx, generated.ID)
+			if err != nil || len(revisions) != 1 || revisions[0].PreviousURL != "https://example.com" ||
+				revisions[0].NewURL != "https://example.com/new" || revisions[0].Actor != "ci" {
+				t.Errorf("Expected one revision, got %+v: %v", revisions, err)
+			}
+			if fresh, created, err := store.CreateURL(ctx, plain); err != nil || !created || fresh.ShortCode == generated.ShortCode {
+				t.Errorf("Expected edited URLs not to be reused, got %+v (created %v): %v", fresh, created, err)
+			}
+
+			if err := store.SetDisabled(ctx, generated.ShortCode, true); err != nil {
+				t.Fatalf("Failed to disable URL: %v", err)
+			}
+			record, err := store.GetURL(ctx, generated.ShortCode)
+			if err != nil || !record.Disabled || record.OriginalURL != "https://example.com/new" {
+				t.Errorf("Expected a disabled, updated URL, got %+v: %v", record, err)
+			}
+
+			stats, err := store.GetStats(ctx, generated.ShortCode)
+			if err != nil || !stats.Disabled || len(stats.RedirectChain) != 1 {
+				t.Errorf("Expected stats with a redirect chain, got %+v: %v", stats, err)
+			}
+
+			if err := store.DeleteURL(ctx, generated.ShortCode); err != nil {
+				t.Fatalf("Failed to delete URL: %v", err)
+			}
+			if _, err := store.GetURL(ctx, generated.ShortCode); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Expected ErrNotFound after delete, got %v", err)
+			}
+			if err := store.DeleteURL(ctx, generated.ShortCode); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Expected ErrNotFound deleting twice, got %v", err)
+			}
+			if err := store.SetDisabled(ctx, generated.ShortCode, false); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Expected ErrNotFound, got %v", err)
+			}
+			if _, err := store.GetStats(ctx, generated.ShortCode); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Expected ErrNotFound, got %v", err)
+			}
+		})
+	}
+}
+
+func TestStore_CreateURLConcurrent(t *testing.T) {
+	ctx := context.Background()
+
+	const destinations, requests = 8, 16
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			var wg sync.WaitGroup
+			codes := make([][]string, destinations)
+			errs := make(chan error, 3*destinations*requests)
+			for d := range destinations {
+				codes[d] = make([]string, requests)
+				destination := fmt.Sprintf("https://example.com/concurrent/%d", d)
+
+				for r := range requests {
+					wg.Add(3)
+					go func() {
+						defer wg.Done()
+						record, _, err := store.CreateURL(ctx, &NewURL{OriginalURL: destination, ReuseKey: destination})
+						if err != nil {
+							errs <- err
+							return
+						}
+						codes[d][r] = record.ShortCode
+					}()
+					// Links that are never shared race for IDs alongside
+					go func() {
+						defer wg.Done()
+						if _, _, err := store.CreateURL(ctx, &NewURL{OriginalURL: destination, MaxClicks: 1}); err != nil {
+							errs <- err
+						}
+					}()
+					// and so do aliases, which must never be refused for an ID taken by another link
+					go func() {
+						defer wg.Done()
+						alias := fmt.Sprintf("concurrent-alias-%d-%d", d, r)
+						if _, _, err := store.CreateURL(ctx, &NewURL{ShortCode: alias, OriginalURL: destination}); err != nil {
+							errs <- err
+						}
+					}()
+				}
+			}
+			wg.Wait()
+			close(errs)
+
+			for err := range errs {
+				t.Errorf("Failed to create URL: %v", err)
+			}
+
+			seen := make(map[string]int)
+			for d := range destinations {
+				for _, code := range codes[d] {
+					if code != codes[d][0] {
+						t.Errorf("Expected one short code for destination %d, got %s and %s", d, codes[d][0], code)
+					}
+				}
+				if other, ok := seen[codes[d][0]]; ok {
+					t.Errorf("Expected destinations %d and %d to have different short codes", other, d)
+				}
+				seen[codes[d][0]] = d
+			}
+		})
+	}
+}
+
+func TestStore_Clicks(t *testing.T) {
+	ctx := context.Background()
+	day := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			record, _, err := store.CreateURL(ctx, &NewURL{OriginalURL: "https://example.com/clicks"})
+			if err != nil {
+				t.Fatalf("Failed to create URL: %v", err)
+			}
+
+			err = store.WriteClicks(ctx, []*Click{
+				{URLID: record.ID, UserAgent: "Firefox", Referer: "https://a.example/", VisitorHash: "visitor-1", Time: day.Add(time.Hour)},
+				{URLID: record.ID, UserAgent: "Firefox", Referer: "https://a.example/", VisitorHash: "visitor-1", Time: day.Add(2 * time.Hour)},
+				{URLID: record.ID, UserAgent: "Chrome", VisitorHash: "visitor-2", Time: day.Add(26 * time.Hour)},
+				{URLID: record.ID, UserAgent: "Googlebot", IsBot: true, VisitorHash: "bot", Time: day.Add(3 * time.Hour)},
+			})
+			if err != nil {
+				t.Fatalf("Failed to write clicks: %v", err)
+			}
+
+			stats, err := store.GetStats(ctx, record.ShortCode)
+			if err != nil || stats.TotalClicks != 3 || stats.BotClicks != 1 ||
+				stats.LastClickedAt == nil || !stats.LastClickedAt.Equal(day.Add(26*time.Hour)) {
+				t.Errorf("Expected 3 clicks and 1 bot click, got %+v: %v", stats, err)
+			}
+
+			counts, err := store.CountClicks(ctx, record.ID, "day", day, day.AddDate(0, 0, 2), false)
+			if err != nil || counts[day] != 2 || counts[day.AddDate(0, 0, 1)] != 1 {
+				t.Errorf("Expected 2 clicks then 1, got %v: %v", counts, err)
+			}
+			counts, err = store.CountClicks(ctx, record.ID, "hour", day, day.Add(4*time.Hour), true)
+			if err != nil || len(counts) != 3 || counts[day.Add(3*time.Hour)] != 1 {
+				t.Errorf("Expected 3 hourly buckets including the bot, got %v: %v", counts, err)
+			}
+
+			to := day.AddDate(0, 0, 1)
+			sources, err := store.ClickSources(ctx, record.ID, nil, &to, false)
+			if err != nil || len(sources) != 1 || sources[0].UserAgent != "Firefox" || sources[0].Clicks != 2 {
+				t.Errorf("Expected 2 Firefox clicks, got %+v: %v", sources, err)
+			}
+
+			visitors, err := store.UniqueVisitors(ctx, record.ShortCode, day)
+			if err != nil || len(visitors) != 2 || visitors[0].Date != "2026-03-02" || visitors[0].Visitors != 1 {
+				t.Errorf("Expected 1 visitor on each day, got %+v: %v", visitors, err)
+			}
+
+			limited, _, err := store.CreateURL(ctx, &NewURL{OriginalURL: "https://example.com/limited", MaxClicks: 1})
+			if err != nil {
+				t.Fatalf("Failed to create URL: %v", err)
+			}
+			if err := store.TrackClick(ctx, &Click{URLID: limited.ID}); err != nil {
+				t.Fatalf("Failed to track click: %v", err)
+			}
+			if err := store.TrackClick(ctx, &Click{URLID: limited.ID}); !errors.Is(err, ErrClickLimitReached) {
+				t.Errorf("Expected ErrClickLimitReached, got %v", err)
+			}
+			if record, err := store.GetURL(ctx, limited.ShortCode); err != nil || record.Clicks != 1 || record.LastClickedAt == nil {
+				t.Errorf("Expected one click, got %+v: %v", record, err)
+			}
+		})
+	}
+}
+
+func TestStore_VisitorSalt(t *testing.T) {
+	ctx := context.Background()
+
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			first, err := store.VisitorSalt(ctx, "2026-03-02", []byte("first"))
+			if err != nil || string(first) != "first" {
+				t.Fatalf("Expected the first salt to be stored, got %q: %v", first, err)
+			}
+
+			// Another replica's salt for the same day loses
+			second, err := store.VisitorSalt(ctx, "2026-03-02", []byte("second"))
+			if err != nil || string(second) != "first" {
+				t.Errorf("Expected the stored salt, got %q: %v", second, err)
+			}
+
+			if next, err := store.VisitorSalt(ctx, "2026-03-03", []byte("next")); err != nil || string(next) != "next" {
+				t.Errorf("Expected a new salt for the next day, got %q: %v", next, err)
+			}
+
+			// Once the next day has started, the previous one never gets a salt again
+			if _, err := store.VisitorSalt(ctx, "2026-03-02", []byte("late")); !errors.Is(err, ErrPastVisitorSalt) {
+				t.Errorf("Expected ErrPastVisitorSalt, got %v", err)
+			}
+		})
+	}
+}
+
+func TestStore_APIKeys(t *testing.T) {
+	ctx := context.Background()
+
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := store.CreateAPIKey(ctx, "ci", "hash-1"); err != nil {
+				t.Fatalf("Failed to create API key: %v", err)
+			}
+			if err := store.CreateAPIKey(ctx, "ci", "hash-2"); !errors.Is(err, ErrAPIKeyExists) {
+				t.Errorf("Expected ErrAPIKeyExists, got %v", err)
+			}
+
+			key, err := store.LookupAPIKey(ctx, "hash-1")
+			if err != nil || key.Name != "ci" {
+				t.Fatalf("Expected the ci key, got %+v: %v", key, err)
+			}
+
+			if revoked, err := store.RevokeAPIKey(ctx, "ci", time.Now()); err != nil || !revoked {
+				t.Fatalf("Expected the key to be revoked, got %v: %v", revoked, err)
+			}
+			if revoked, err := store.RevokeAPIKey(ctx, "ci", time.Now()); err != nil || revoked {
+				t.Errorf("Expected nothing to revoke, got %v: %v", revoked, err)
+			}
+			if _, err := store.LookupAPIKey(ctx, "hash-1"); !errors.Is(err, ErrInvalidAPIKey) {
+				t.Errorf("Expected ErrInvalidAPIKey, got %v", err)
+			}
+
+			keys, err := store.ListAPIKeys(ctx)
+			if err != nil || len(keys) != 1 || keys[0].RevokedAt == nil {
+				t.Errorf("Expected one revoked key, got %+v: %v", keys, err)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreApp(t *testing.T) {
+	app, err := NewApp(context.Background(), &Config{
+		DatabaseURL: "memory://",
+		Port:        "7000",
+		BaseURL:     "http://localhost:7000",
+	}, WithResolver(publicResolver{}))
+	if err != nil {
+		t.Fatalf("Failed to create app: %v", err)
+	}
+	defer app.store.Close()
+
+	resp, err := app.createShortURL(context.Background(), &ShortenRequest{URL: "https://example.com/memory"})
+	if err != nil {
+		t.Fatalf("Failed to create short URL: %v", err)
+	}
+
+	mux := app.setupRoutes()
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/"+resp.ShortCode, nil))
+	if rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != "https://example.com/memory" {
+		t.Fatalf("Expected a redirect, got %d to %q", rec.Code, rec.Header().Get("Location"))
+	}
+
+	if err := app.clicks.Close(context.Background()); err != nil {
+		t.Fatalf("Failed to flush clicks: %v", err)
+	}
+	stats, err := app.getStats(context.Background(), resp.ShortCode)
+	if err != nil || stats.TotalClicks != 1 {
+		t.Errorf("Expected 1 click, got %+v: %v", stats, err)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected a ready instance, got %d", rec.Code)
+	}
+
+	if err := app.runMigrateCommand([]string{"status"}); err == nil {
+		t.Error("Expected migrate to fail without a SQL store")
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.39.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// tracerName identifies the spans created by ul
+const tracerName = "github.com/sardonyx001/ul"
+
+// tracePropagator reads and writes W3C trace context and baggage headers
+var tracePropagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// noopTracer is used while tracing is disabled
+var noopTracer = noop.NewTracerProvider().Tracer(tracerName)
+
+// newTracerProvider creates a provider sending spans to exporter, sampling
+// Config.TraceSampleRatio of new traces and following the caller's decision
+// for traces started upstream. Exporting is synchronous when batch is false.
+func newTracerProvider(exporter sdktrace.SpanExporter, sampleRatio float64, batch bool) *sdktrace.TracerProvider {
+	processor := sdktrace.NewSimpleSpanProcessor(exporter)
+	if batch {
+		processor = sdktrace.NewBatchSpanProcessor(exporter)
+	}
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(processor),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName("ul"), semconv.ServiceVersion(Version))),
+	)
+}
+
+// setupTracing exports spans over OTLP/HTTP to Config.OTLPEndpoint, if set
+func (a *App) setupTracing(ctx context.Context) error {
+	a.tracer = noopTracer
+	if a.config.OTLPEndpoint == "" {
+		return nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(a.config.OTLPEndpoint))
+	if err != nil {
+		return fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+
+	a.setTracerProvider(newTracerProvider(exporter, a.config.TraceSampleRatio, true))
+	log.Info("Tracing enabled", "endpoint", a.config.OTLPEndpoint, "sample_ratio", a.config.TraceSampleRatio)
+	return nil
+}
+
+// setTracerProvider replaces the app's tracer provider, shutting down the previous one
+func (a *App) setTracerProvider(provider *sdktrace.TracerProvider) {
+	if a.tracerProvider != nil {
+		a.tracerProvider.Shutdown(context.Background())
+	}
+	a.tracerProvider = provider
+	a.tracer = provider.Tracer(tracerName)
+}
+
+// WithSpanExporter sends every span to exporter as soon as it ends, replacing
+// any OTLP exporter from Config. Tests use it with an in-memory exporter.
+func WithSpanExporter(exporter sdktrace.SpanExporter) AppOption {
+	return func(a *App) error {
+		if exporter == nil {
+			return fmt.Errorf("span exporter cannot be nil")
+		}
+		a.setTracerProvider(newTracerProvider(exporter, a.config.TraceSampleRatio, false))
+		return nil
+	}
+}
+
+// shutdownTracing flushes spans that haven't been exported yet
+func (a *App) shutdownTracing(ctx context.Context) error {
+	if a.tracerProvider == nil {
+		return nil
+	}
+	return a.tracerProvider.Shutdown(ctx)
+}
+
+// endSpan records err on span, if any, and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil && err != ErrNotFound {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// tracingMiddleware continues the trace from incoming W3C traceparent headers,
+// or starts a new one, with a server span named after the route pattern the
+// request matches in mux
+func (a *App) tracingMiddleware(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := tracePropagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		_, pattern := mux.Handler(r)
+		name := pattern
+		if name == "" {
+			name = r.Method
+		}
+
+		ctx, span := a.tracer.Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+			),
+		)
+		defer span.End()
+		if pattern != "" {
+			span.SetAttributes(semconv.HTTPRoute(pattern))
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		status := recorder.statusCode()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// spansByName indexes the spans an exporter has received by their name
+func spansByName(exporter *tracetest.InMemoryExporter) map[string]tracetest.SpanStub {
+	spans := make(map[string]tracetest.SpanStub)
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	return spans
+}
+
+func TestTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	cfg := &Config{
+		DatabaseURL:      "file::memory:?cache=shared",
+		Port:             "7000",
+		BaseURL:          "http://localhost:7000",
+		TraceSampleRatio: 1,
+	}
+
+	app, err := NewApp(context.Background(), cfg, WithSpanExporter(exporter), WithResolver(publicResolver{}))
+	if err != nil {
+		t.Fatalf("Failed to create app: %v", err)
+	}
+	defer app.store.Close()
+
+	// The gateway's trace is continued from the traceparent header
+	req := httptest.NewRequest("POST", "/s", strings.NewReader(`{"url":"https://www.example.com/traced","max_clicks":5}`))
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	app.server.Handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body.String())
+	}
+
+	var resp ShortenResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	spans := spansByName(exporter)
+	server, ok := spans["POST /s"]
+	if !ok {
+		t.Fatalf("Expected a POST /s span, got %v", spans)
+	}
+	if server.SpanKind != trace.SpanKindServer || server.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" ||
+		server.Parent.SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("Expected a server span continuing the incoming trace, got %+v", server)
+	}
+
+	create, ok := spans["createShortURL"]
+	if !ok || create.Parent.SpanID() != server.SpanContext.SpanID() {
+		t.Errorf("Expected a createShortURL span under the server span, got %+v", create)
+	}
+
+	// Each request without a traceparent header starts its own trace
+	exporter.Reset()
+	for _, path := range []string{"/" + resp.ShortCode, "/" + resp.ShortCode + "/qr"} {
+		app.server.Handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	spans = spansByName(exporter)
+	for _, name := range []string{"GET /{shortCode}", "GET /{shortCode}/qr", "getURL", "trackClick", "renderQR"} {
+		if _, ok := spans[name]; !ok {
+			t.Errorf("Expected a %s span", name)
+		}
+	}
+
+	redirect := spans["GET /{shortCode}"]
+	if spans["trackClick"].Parent.SpanID() != redirect.SpanContext.SpanID() {
+		t.Error("Expected trackClick under the redirect span")
+	}
+	for _, attr := range redirect.Attributes {
+		if attr.Key == "http.response.status_code" && attr.Value.AsInt64() != http.StatusFound {
+			t.Errorf("Expected status code attribute %d, got %d", http.StatusFound, attr.Value.AsInt64())
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// uaRule maps a user-agent substring to a name. Rules are checked in order,
+// so more specific tokens must come before the ones they contain.
+type uaRule struct {
+	token string
+	name  string
+}
+
+// browserRules identify browser families. Most browsers also claim to be
+// Safari or Chrome, so those are checked last.
+var browserRules = []uaRule{
+	{"edg/", "Edge"},
+	{"edga/", "Edge"},
+	{"edgios/", "Edge"},
+	{"edge/", "Edge"},
+	{"opr/", "Opera"},
+	{"opera", "Opera"},
+	{"samsungbrowser/", "Samsung Internet"},
+	{"yabrowser/", "Yandex Browser"},
+	{"ucbrowser/", "UC Browser"},
+	{"firefox/", "Firefox"},
+	{"fxios/", "Firefox"},
+	{"crios/", "Chrome"},
+	{"chromium/", "Chromium"},
+	{"chrome/", "Chrome"},
+	{"msie ", "Internet Explorer"},
+	{"trident/", "Internet Explorer"},
+	{"safari/", "Safari"},
+	{"curl/", "curl"},
+	{"wget/", "Wget"},
+}
+
+// osRules identify operating systems. iOS and Android are checked before the
+// desktop systems their user agents mention.
+var osRules = []uaRule{
+	{"iphone", "iOS"},
+	{"ipad", "iOS"},
+	{"ipod", "iOS"},
+	{"android", "Android"},
+	{"windows", "Windows"},
+	{"cros", "ChromeOS"},
+	{"mac os x", "macOS"},
+	{"macintosh", "macOS"},
+	{"linux", "Linux"},
+}
+
+// Device classes reported by parseUserAgent
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+	DeviceUnknown = "unknown"
+)
+
+// UserAgent is the parsed form of a User-Agent header
+type UserAgent struct {
+	Browser string
+	OS      string
+	Device  string
+}
+
+// matchRule returns the name of the first rule found in ua, or fallback
+func matchRule(ua string, rules []uaRule, fallback string) string {
+	for _, rule := range rules {
+		if strings.Contains(ua, rule.token) {
+			return rule.name
+		}
+	}
+	return fallback
+}
+
+// parseUserAgent extracts the browser family, OS and device class from a
+// User-Agent header. It only knows common clients; anything else is "Other".
+func parseUserAgent(header string) UserAgent {
+	ua := strings.ToLower(header)
+	if ua == "" {
+		return UserAgent{Browser: "Unknown", OS: "Unknown", Device: DeviceUnknown}
+	}
+
+	parsed := UserAgent{
+		Browser: matchRule(ua, browserRules, "Other"),
+		OS:      matchRule(ua, osRules, "Other"),
+	}
+
+	switch {
+	case isBotUserAgent(ua):
+		parsed.Device = DeviceBot
+	case strings.Contains(ua, "ipad") || strings.Contains(ua, "tablet") ||
+		(strings.Contains(ua, "android") && !strings.Contains(ua, "mobile")):
+		parsed.Device = DeviceTablet
+	case strings.Contains(ua, "mobi") || strings.Contains(ua, "iphone") || strings.Contains(ua, "ipod"):
+		parsed.Device = DeviceMobile
+	case parsed.OS != "Other":
+		parsed.Device = DeviceDesktop
+	default:
+		parsed.Device = DeviceUnknown
+	}
+
+	return parsed
+}
+
+// referrerDomain returns the host of a Referer header without a leading "www.",
+// "(direct)" if there is none and "(invalid)" if it can't be parsed
+func referrerDomain(referer string) string {
+	if referer == "" {
+		return "(direct)"
+	}
+
+	u, err := url.Parse(referer)
+	if err != nil || u.Hostname() == "" {
+		return "(invalid)"
+	}
+
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
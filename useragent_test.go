@@ -0,0 +1,76 @@
+package main
+
+import "testing"
+
+func TestParseUserAgent(t *testing.T) {
+	testCases := []struct {
+		ua       string
+		expected UserAgent
+		name     string
+	}{
+		{
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			UserAgent{"Chrome", "Windows", DeviceDesktop}, "chrome on windows",
+		},
+		{
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.0.0",
+			UserAgent{"Edge", "Windows", DeviceDesktop}, "edge on windows",
+		},
+		{
+			"Mozilla/5.0 (Macintosh; Intel Mac OS X 14_2) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Safari/605.1.15",
+			UserAgent{"Safari", "macOS", DeviceDesktop}, "safari on macos",
+		},
+		{
+			"Mozilla/5.0 (iPhone; CPU iPhone OS 17_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Mobile/15E148 Safari/604.1",
+			UserAgent{"Safari", "iOS", DeviceMobile}, "safari on iphone",
+		},
+		{
+			"Mozilla/5.0 (iPad; CPU OS 17_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/120.0 Mobile/15E148 Safari/604.1",
+			UserAgent{"Chrome", "iOS", DeviceTablet}, "chrome on ipad",
+		},
+		{
+			"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36",
+			UserAgent{"Chrome", "Android", DeviceMobile}, "chrome on android phone",
+		},
+		{
+			"Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/23.0 Chrome/115.0.0.0 Safari/537.36",
+			UserAgent{"Samsung Internet", "Android", DeviceTablet}, "samsung internet on android tablet",
+		},
+		{
+			"Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0",
+			UserAgent{"Firefox", "Linux", DeviceDesktop}, "firefox on linux",
+		},
+		{
+			"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			UserAgent{"Other", "Other", DeviceBot}, "googlebot",
+		},
+		{"curl/8.4.0", UserAgent{"curl", "Other", DeviceBot}, "curl"},
+		{"", UserAgent{"Unknown", "Unknown", DeviceUnknown}, "empty"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if parsed := parseUserAgent(tc.ua); parsed != tc.expected {
+				t.Errorf("Expected %+v, got %+v", tc.expected, parsed)
+			}
+		})
+	}
+}
+
+func TestReferrerDomain(t *testing.T) {
+	testCases := []struct {
+		referer  string
+		expected string
+	}{
+		{"", "(direct)"},
+		{"https://www.Google.com/search?q=ul", "google.com"},
+		{"https://news.ycombinator.com/item?id=1", "news.ycombinator.com"},
+		{"not a url", "(invalid)"},
+	}
+
+	for _, tc := range testCases {
+		if domain := referrerDomain(tc.referer); domain != tc.expected {
+			t.Errorf("Expected '%s' for '%s', got '%s'", tc.expected, tc.referer, domain)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// uniqueVisitorDays is how many days of unique visitor counts URLStats reports
+const uniqueVisitorDays = 30
+
+// ErrPastVisitorSalt is returned when asked for the salt of a day that has
+// passed. Those salts are deleted and never recreated, so that visitor hashes
+// can't be linked across days.
+var ErrPastVisitorSalt = errors.New("visitor salt of a past day")
+
+// DailyVisitors is the number of distinct visitors to a link on one UTC day
+type DailyVisitors struct {
+	Date     string `json:"date"`
+	Visitors int64  `json:"visitors"`
+}
+
+// visitorSalts hands out the random salt of the current UTC day. Salts are
+// shared between replicas through the Store, and the salts of previous days
+// are deleted so visitor hashes can't be linked across days.
+type visitorSalts struct {
+	mu   sync.Mutex
+	day  string
+	salt []byte
+}
+
+// get returns the salt for day, creating it if needed
+func (s *visitorSalts) get(ctx context.Context, store Store, day string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.day == day {
+		return s.salt, nil
+	}
+	if day < s.day {
+		return nil, fmt.Errorf("%w: %s", ErrPastVisitorSalt, day)
+	}
+
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate visitor salt: %w", err)
+	}
+
+	// Another replica may have created today's salt first, in which case we use theirs
+	salt, err := store.VisitorSalt(ctx, day, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	s.day, s.salt = day, salt
+	return salt, nil
+}
+
+// watch moves on to the salt of each new UTC day as soon as it starts, which
+// deletes the salts of earlier days even if nobody clicks a link that day.
+// It runs until ctx is done.
+func (s *visitorSalts) watch(ctx context.Context, store Store) {
+	for {
+		now := time.Now()
+		if _, err := s.get(ctx, store, now.UTC().Format(time.DateOnly)); err != nil {
+			log.Error("Failed to rotate visitor salt", "error", err)
+		}
+
+		timer := time.NewTimer(truncateDay(now).AddDate(0, 0, 1).Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// visitorHash returns an anonymous identifier for a visitor on the day of now,
+// derived from their IP address and user agent. It returns "" if the IP is
+// unknown. Hashes are computed when a click happens, since the salt of a day
+// is gone once the next day starts.
+func (a *App) visitorHash(ctx context.Context, ip, userAgent string, now time.Time) (string, error) {
+	if ip == "" {
+		return "", nil
+	}
+
+	salt, err := a.salts.get(ctx, a.store, now.UTC().Format(time.DateOnly))
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, salt)
+	mac.Write([]byte(ip))
+	mac.Write([]byte{0})
+	mac.Write([]byte(userAgent))
+	return hex.EncodeToString(mac.Sum(nil)[:16]), nil
+}
+
+// getUniqueVisitors counts the distinct visitors to a short code per day over
+// the last uniqueVisitorDays days, skipping days without clicks. Bots are never
+// counted as visitors.
+func (a *App) getUniqueVisitors(ctx context.Context, shortCode string, now time.Time) ([]DailyVisitors, error) {
+	since := truncateDay(now).AddDate(0, 0, -(uniqueVisitorDays - 1))
+
+	return a.store.UniqueVisitors(ctx, shortCode, since)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestVisitorHash(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	today := time.Now().UTC()
+	tomorrow := today.AddDate(0, 0, 1)
+
+	first, err := app.visitorHash(context.Background(), "192.0.2.1", "Test-Agent", today)
+	if err != nil {
+		t.Fatalf("Failed to hash visitor: %v", err)
+	}
+	again, _ := app.visitorHash(context.Background(), "192.0.2.1", "Test-Agent", today)
+	otherIP, _ := app.visitorHash(context.Background(), "192.0.2.2", "Test-Agent", today)
+	otherAgent, _ := app.visitorHash(context.Background(), "192.0.2.1", "Other-Agent", today)
+
+	if first == "" || first != again {
+		t.Errorf("Expected a stable hash within a day, got '%s' and '%s'", first, again)
+	}
+	if first == otherIP || first == otherAgent {
+		t.Error("Expected different visitors to hash differently")
+	}
+
+	nextDay, err := app.visitorHash(context.Background(), "192.0.2.1", "Test-Agent", tomorrow)
+	if err != nil {
+		t.Fatalf("Failed to hash visitor: %v", err)
+	}
+	if nextDay == first {
+		t.Error("Expected the hash to change with the day")
+	}
+
+	// Once a day has passed its salt is gone for good
+	var salts int
+	if err := testDB(app).QueryRow("SELECT COUNT(*) FROM visitor_salts WHERE day < ?", tomorrow.Format(time.DateOnly)).Scan(&salts); err != nil {
+		t.Fatalf("Failed to count salts: %v", err)
+	}
+	if salts != 0 {
+		t.Errorf("Expected previous salts to be deleted, found %d", salts)
+	}
+
+	// Nor are they created again for clicks hashed late
+	if _, err := app.visitorHash(context.Background(), "192.0.2.1", "Test-Agent", today); !errors.Is(err, ErrPastVisitorSalt) {
+		t.Errorf("Expected ErrPastVisitorSalt for a past day, got: %v", err)
+	}
+
+	if hash, err := app.visitorHash(context.Background(), "", "Test-Agent", today); err != nil || hash != "" {
+		t.Errorf("Expected no hash without an IP, got '%s' (%v)", hash, err)
+	}
+}
+
+func TestVisitorSalts_Watch(t *testing.T) {
+	ctx := context.Background()
+	today := time.Now().UTC().Format(time.DateOnly)
+	yesterday := time.Now().UTC().AddDate(0, 0, -1).Format(time.DateOnly)
+
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			var salts visitorSalts
+			if _, err := salts.get(ctx, store, yesterday); err != nil {
+				t.Fatalf("Failed to create salt: %v", err)
+			}
+
+			// Nobody clicks anything today, yet yesterday's salt must go
+			watchCtx, cancel := context.WithCancel(ctx)
+			done := make(chan struct{})
+			go func() {
+				salts.watch(watchCtx, store)
+				close(done)
+			}()
+			defer func() {
+				cancel()
+				<-done
+			}()
+
+			deadline := time.Now().Add(2 * time.Second)
+			for {
+				days := storedSaltDays(t, store)
+				if len(days) == 1 && days[0] == today {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("Expected only the salt of %s, got %v", today, days)
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		})
+	}
+}
+
+// storedSaltDays lists the days a store holds visitor salts for
+func storedSaltDays(t *testing.T, store Store) []string {
+	t.Helper()
+
+	var days []string
+	switch store := store.(type) {
+	case *memoryStore:
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		for day := range store.salts {
+			days = append(days, day)
+		}
+	case *sqlStore:
+		rows, err := store.db.Query("SELECT day FROM visitor_salts")
+		if err != nil {
+			t.Fatalf("Failed to list salts: %v", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var day string
+			if err := rows.Scan(&day); err != nil {
+				t.Fatalf("Failed to scan salt: %v", err)
+			}
+			days = append(days, day)
+		}
+	default:
+		t.Fatalf("Unexpected store %T", store)
+	}
+
+	return days
+}
+
+func TestGetStats_UniqueVisitors(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.store.Close()
+
+	resp, err := app.createShortURL(context.Background(), &ShortenRequest{URL: "https://www.example.com/unique-visitors"})
+	if err != nil {
+		t.Fatalf("Failed to create short URL: %v", err)
+	}
+	record, err := app.getURL(context.Background(), resp.ShortCode)
+	if err != nil {
+		t.Fatalf("Failed to get URL: %v", err)
+	}
+
+	for _, click := range []struct{ remoteAddr, userAgent string }{
+		{"192.0.2.1:1234", "Test-Agent"},
+		{"192.0.2.1:5678", "Test-Agent"},
+		{"192.0.2.1:1234", "Other-Agent"},
+		{"192.0.2.2:1234", "Test-Agent"},
+		{"", "Test-Agent"},
+	} {
+		req := httptest.NewRequest("GET", "/"+record.ShortCode, nil)
+		req.RemoteAddr = click.remoteAddr
+		req.Header.Set("User-Agent", click.userAgent)
+		app.handleRedirect(httptest.NewRecorder(), req)
+	}
+
+	// Visitors are hashed when they click, before the queue writes the clicks
+	if err := app.clicks.Close(context.Background()); err != nil {
+		t.Fatalf("Failed to drain click queue: %v", err)
+	}
+
+	stats, err := app.getStats(context.Background(), resp.ShortCode)
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+
+	if stats.TotalClicks != 5 {
+		t.Errorf("Expected 5 clicks, got %d", stats.TotalClicks)
+	}
+
+	today := time.Now().UTC().Format(time.DateOnly)
+	if len(stats.UniqueVisitors) != 1 || stats.UniqueVisitors[0] != (DailyVisitors{today, 3}) {
+		t.Errorf("Expected 3 unique visitors on %s, got %v", today, stats.UniqueVisitors)
+	}
+
+	// Raw IPs are never stored
+	var stored int
+	if err := testDB(app).QueryRow("SELECT COUNT(*) FROM clicks WHERE visitor_hash LIKE '%192.0.2%'").Scan(&stored); err != nil {
+		t.Fatalf("Failed to query clicks: %v", err)
+	}
+	if stored != 0 {
+		t.Error("Expected IPs not to be stored in visitor hashes")
+	}
+}